@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// requireAdmin checks that the caller's certificate carries the role=admin
+// attribute
+func requireAdmin(stub shim.ChaincodeStubInterface) error {
+	err := cid.AssertAttributeValue(stub, "role", "admin")
+	if err != nil {
+		return fmt.Errorf("Caller is not an admin: %s", err)
+	}
+	return nil
+}
+
+// requireComplianceOfficer checks that the caller's certificate carries the
+// role=compliance attribute
+func requireComplianceOfficer(stub shim.ChaincodeStubInterface) error {
+	err := cid.AssertAttributeValue(stub, "role", "compliance")
+	if err != nil {
+		return fmt.Errorf("Caller is not a compliance officer: %s", err)
+	}
+	return nil
+}
+
+// requireBankAdmin checks that the caller's certificate carries a bank-admin
+// attribute naming bank
+func requireBankAdmin(stub shim.ChaincodeStubInterface, bank string) error {
+	adminOf, found, err := cid.GetAttributeValue(stub, "bank-admin")
+	if err != nil {
+		return err
+	}
+	if !found || adminOf != bank {
+		return fmt.Errorf("Caller is not an admin of bank %s", bank)
+	}
+	return nil
+}
+
+// requireOwnerOrBankAdmin checks that the caller created the account or is
+// an admin of the account's bank. Accounts without a recorded owner, such as
+// those seeded by initLedger, can only be operated by a bank admin.
+func requireOwnerOrBankAdmin(stub shim.ChaincodeStubInterface, account Account) error {
+	mspID, subject, err := getCallerIdentity(stub)
+	if err != nil {
+		return err
+	}
+	if account.OwnerMSPID != "" && mspID == account.OwnerMSPID && subject == account.OwnerSubject {
+		return nil
+	}
+	if requireBankAdmin(stub, account.Bank) == nil {
+		return nil
+	}
+	return fmt.Errorf("Caller does not own account %s and is not an admin of bank %s", account.AccountNumber, account.Bank)
+}
+
+// getCallerIdentity returns the MSP ID and certificate subject of the caller
+func getCallerIdentity(stub shim.ChaincodeStubInterface) (string, string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", "", err
+	}
+	certificate, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return "", "", err
+	}
+	if certificate == nil {
+		return "", "", fmt.Errorf("Caller has no X.509 certificate")
+	}
+	return mspID, certificate.Subject.String(), nil
+}
@@ -2,20 +2,70 @@ package main
 
 //import format "fmt"
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"strconv"
+	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
 )
 
 // Account defined as struct
 type Account struct {
 	AccountNumber string `json:"AccountNumber"`
 	FirstName     string `json:"FirstName"`
-	Amount        int    `json:"Amount"`
 	Bank          string `json:"Bank"`
+	// Currency is the ISO-4217 home currency of the account
+	Currency string `json:"Currency"`
+	// Balances holds one balance per ISO-4217 currency code
+	Balances map[string]money.Amount `json:"Balances"`
+	// OverdraftLimit is how far below zero the home currency balance may go
+	OverdraftLimit money.Amount `json:"OverdraftLimit"`
+	// InterestRate is the simple annual rate on the home currency balance,
+	// fixed-point with rateDecimals decimal places
+	InterestRate int64 `json:"InterestRate"`
+	// LastAccrual is the transaction time interest was last accrued up to
+	LastAccrual time.Time `json:"LastAccrual"`
+	// InterestCarry is the interest below a cent not yet credited, in
+	// units of 1/(secondsPerYear * 10^rateDecimals) of a cent
+	InterestCarry int64 `json:"InterestCarry"`
+	// Status is StatusActive, StatusFrozen or StatusClosed
+	Status       string `json:"Status"`
+	StatusReason string `json:"StatusReason"`
+	// Holds reserve part of a balance without moving it
+	Holds []Hold `json:"Holds"`
+	// OwnerMSPID and OwnerSubject identify the client that created the
+	// account; only it or an admin of Bank may move funds or close it
+	OwnerMSPID   string `json:"OwnerMSPID"`
+	OwnerSubject string `json:"OwnerSubject"`
+	// ClosingTxID is the transaction that closed the account
+	ClosingTxID string `json:"ClosingTxID"`
+	// TxLimit and DailyLimit cap single and rolling 24-hour outflows in the
+	// home currency; zero means no limit
+	TxLimit    money.Amount `json:"TxLimit"`
+	DailyLimit money.Amount `json:"DailyLimit"`
+	// Outflows are the hourly outflow totals of the last 24 hours
+	Outflows []Outflow `json:"Outflows"`
+}
+
+// TransferReceipt is returned by transfer with the balances after the move.
+// FromInterest and ToInterest are the interest posted to each account
+// before it.
+type TransferReceipt struct {
+	TxID           string       `json:"TxID"`
+	From           string       `json:"From"`
+	To             string       `json:"To"`
+	Currency       string       `json:"Currency"`
+	Amount         money.Amount `json:"Amount"`
+	CreditCurrency string       `json:"CreditCurrency"`
+	CreditAmount   money.Amount `json:"CreditAmount"`
+	Fee            money.Amount `json:"Fee"`
+	FromInterest   money.Amount `json:"FromInterest"`
+	ToInterest     money.Amount `json:"ToInterest"`
+	FromBalance    money.Amount `json:"FromBalance"`
+	ToBalance      money.Amount `json:"ToBalance"`
 }
 
 // SmartContract defined as struct
@@ -57,19 +107,68 @@ func (smartcontract *SmartContract) Invoke(stub shim.ChaincodeStubInterface) pee
 		return smartcontract.createAccount(stub, args)
 	} else if function == "queryAllAccounts" {
 		return smartcontract.queryAllAccounts(stub)
-	} else if function == "deleteAccount" {
-		return smartcontract.deleteAccount(stub, args)
+	} else if function == "closeAccount" || function == "deleteAccount" {
+		// deleteAccount is kept as an alias; accounts are never deleted
+		return smartcontract.closeAccount(stub, args)
+	} else if function == "reopenAccount" {
+		return smartcontract.reopenAccount(stub, args)
 	} else if function == "deposit" {
 		return smartcontract.deposit(stub, args)
 	} else if function == "getHistory" {
 		return smartcontract.getHistory(stub, args)
+	} else if function == "transfer" {
+		return smartcontract.transfer(stub, args)
+	} else if function == "withdraw" {
+		return smartcontract.withdraw(stub, args)
+	} else if function == "setOverdraftLimit" {
+		return smartcontract.setOverdraftLimit(stub, args)
+	} else if function == "setExchangeRate" {
+		return smartcontract.setExchangeRate(stub, args)
+	} else if function == "queryExchangeRate" {
+		return smartcontract.queryExchangeRate(stub, args)
+	} else if function == "setInterestRate" {
+		return smartcontract.setInterestRate(stub, args)
+	} else if function == "accrueInterest" {
+		return smartcontract.accrueInterest(stub, args)
+	} else if function == "getAccruals" {
+		return smartcontract.getAccruals(stub, args)
+	} else if function == "freezeAccount" {
+		return smartcontract.freezeAccount(stub, args)
+	} else if function == "unfreezeAccount" {
+		return smartcontract.unfreezeAccount(stub, args)
+	} else if function == "placeHold" {
+		return smartcontract.placeHold(stub, args)
+	} else if function == "releaseHold" {
+		return smartcontract.releaseHold(stub, args)
+	} else if function == "settle" {
+		return smartcontract.settle(stub, args)
+	} else if function == "querySettlement" {
+		return smartcontract.querySettlement(stub, args)
+	} else if function == "getStatement" {
+		return smartcontract.getStatement(stub, args)
+	} else if function == "queryAccountsByBank" {
+		return smartcontract.queryAccountsByBank(stub, args)
+	} else if function == "queryAccountsByOwner" {
+		return smartcontract.queryAccountsByOwner(stub, args)
+	} else if function == "createStandingOrder" {
+		return smartcontract.createStandingOrder(stub, args)
+	} else if function == "cancelStandingOrder" {
+		return smartcontract.cancelStandingOrder(stub, args)
+	} else if function == "queryStandingOrder" {
+		return smartcontract.queryStandingOrder(stub, args)
+	} else if function == "executeDueOrders" {
+		return smartcontract.executeDueOrders(stub, args)
+	} else if function == "setSpendingLimits" {
+		return smartcontract.setSpendingLimits(stub, args)
+	} else if function == "setFee" {
+		return smartcontract.setFee(stub, args)
+	} else if function == "queryFeeSchedule" {
+		return smartcontract.queryFeeSchedule(stub, args)
+	} else if function == "queryFeesCollected" {
+		return smartcontract.queryFeesCollected(stub, args)
+	} else if function == "trialBalance" {
+		return smartcontract.trialBalance(stub, args)
 	}
-	/*	} else if function == "deposit" {
-			return smartcontract.deposit(stub, args)
-		} else if function == "transfer" {
-			return smartcontract.transfer(stub, args)
-		}
-	*/
 	return shim.Error("Invalid Smart Contract function name.")
 }
 
@@ -77,11 +176,11 @@ func (smartcontract *SmartContract) initLedger(stub shim.ChaincodeStubInterface)
 	fmt.Println("=============== Start Init Ledger ===============")
 
 	accounts := []Account{
-		Account{AccountNumber: "1010", FirstName: "Elrond", Amount: 100, Bank: "akbank"},
-		Account{AccountNumber: "2020", FirstName: "Arwen", Amount: 200, Bank: "teb"},
-		Account{AccountNumber: "3030", FirstName: "Aragorn", Amount: 300, Bank: "isbank"},
-		Account{AccountNumber: "4040", FirstName: "Legolas", Amount: 400, Bank: "finansbank"},
-		Account{AccountNumber: "5050", FirstName: "Frodo", Amount: 500, Bank: "akbank"},
+		Account{AccountNumber: "1010", FirstName: "Elrond", Bank: "akbank", Currency: "TRY", Status: StatusActive, Balances: map[string]money.Amount{"TRY": money.MustParse("100")}},
+		Account{AccountNumber: "2020", FirstName: "Arwen", Bank: "teb", Currency: "EUR", Status: StatusActive, Balances: map[string]money.Amount{"EUR": money.MustParse("200")}},
+		Account{AccountNumber: "3030", FirstName: "Aragorn", Bank: "isbank", Currency: "USD", Status: StatusActive, Balances: map[string]money.Amount{"USD": money.MustParse("300")}},
+		Account{AccountNumber: "4040", FirstName: "Legolas", Bank: "finansbank", Currency: "TRY", Status: StatusActive, Balances: map[string]money.Amount{"TRY": money.MustParse("400")}},
+		Account{AccountNumber: "5050", FirstName: "Frodo", Bank: "akbank", Currency: "TRY", Status: StatusActive, Balances: map[string]money.Amount{"TRY": money.MustParse("500")}},
 	}
 
 	i := 0
@@ -89,6 +188,14 @@ func (smartcontract *SmartContract) initLedger(stub shim.ChaincodeStubInterface)
 		accountAsBytes, _ := json.Marshal(accounts[i])
 		err := stub.PutState("ACCOUNT"+accounts[i].AccountNumber, accountAsBytes)
 
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = putAccountIndexes(stub, accounts[i])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = postOpeningBalance(stub, accounts[i])
 		if err != nil {
 			return shim.Error(err.Error())
 		}
@@ -123,23 +230,58 @@ func (smartcontract *SmartContract) queryAccount(stub shim.ChaincodeStubInterfac
 func (smartcontract *SmartContract) createAccount(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	fmt.Println("=============== Start Create Account ===============")
 
-	if len(args) != 4 {
+	if len(args) != 5 {
 		return shim.Error("Invalid number of args")
 	}
 
 	accountNumber := args[0]
 	firstName := args[1]
-	amount, err := strconv.Atoi(args[2])
-	bank := args[4]
+	amount, err := money.Parse(args[2])
+	bank := args[3]
+	currency := args[4]
+
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if amount < 0 {
+		return shim.Error("Opening amount cannot be negative")
+	}
+	if err := validateCurrency(currency); err != nil {
+		return shim.Error(err.Error())
+	}
 
+	// Overwriting an existing account would hand it to the caller.
+	existingAsBytes, err := stub.GetState("ACCOUNT" + accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existingAsBytes != nil {
+		return shim.Error("Account " + accountNumber + " already exists")
+	}
+
+	ownerMSPID, ownerSubject, err := getCallerIdentity(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	account := Account{AccountNumber: accountNumber, FirstName: firstName, Amount: amount, Bank: bank}
+	account := Account{AccountNumber: accountNumber, FirstName: firstName, Bank: bank, Currency: currency, Status: StatusActive, Balances: map[string]money.Amount{currency: amount}, OwnerMSPID: ownerMSPID, OwnerSubject: ownerSubject}
 
-	accountAsBytes, err := json.Marshal(account)
-	stub.PutState("ACCOUNT"+account.AccountNumber, accountAsBytes)
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAccountIndexes(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = postOpeningBalance(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventAccountCreated, AccountNumber: accountNumber, Currency: currency, Amount: amount, NewBalance: amount})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	fmt.Println("=============== End Create Account ===============")
 	return shim.Success(nil)
 }
@@ -147,8 +289,10 @@ func (smartcontract *SmartContract) createAccount(stub shim.ChaincodeStubInterfa
 func (smartcontract *SmartContract) queryAllAccounts(stub shim.ChaincodeStubInterface) peer.Response {
 	fmt.Println("=============== Start Query All Account ===============")
 
-	startKey := "ACCOUNT0000"
-	endKey := "ACCOUNT9999"
+	// Every simple key starting with ACCOUNT, whatever the account number
+	// looks like; composite keys start with a null byte and are not matched.
+	startKey := "ACCOUNT"
+	endKey := "ACCOUNU"
 
 	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
 
@@ -156,8 +300,12 @@ func (smartcontract *SmartContract) queryAllAccounts(stub shim.ChaincodeStubInte
 		return shim.Error(err.Error())
 	}
 
-	resultsIterator.Close()
+	defer resultsIterator.Close()
 
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
@@ -165,68 +313,191 @@ func (smartcontract *SmartContract) queryAllAccounts(stub shim.ChaincodeStubInte
 		}
 		jsonResp := "AccountID: " + queryResponse.Key + ", Account info: " + string(queryResponse.Value)
 		fmt.Println(jsonResp)
+
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResponse.Value)
+		bArrayMemberAlreadyWritten = true
 	}
+	buffer.WriteString("]")
+
 	fmt.Println("=============== End Query All Account ===============")
-	return shim.Success(nil)
+	return shim.Success(buffer.Bytes())
 }
 
-func (smartcontract *SmartContract) deleteAccount(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	fmt.Println("=============== Start Delete Account ===============")
+func (smartcontract *SmartContract) deposit(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Deposit ===============")
 
-	if len(args) != 1 {
+	if len(args) != 3 {
 		return shim.Error("Invalid number of args")
 	}
 
-	accountID := args[0]
-
-	err := stub.DelState(accountID)
+	accountNumber := args[0]
+	depositAmount, err := parsePositiveAmount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	currency := args[2]
+	if err := validateCurrency(currency); err != nil {
+		return shim.Error(err.Error())
+	}
 
+	account, err := getAccount(stub, accountNumber)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := requireOwnerOrBankAdmin(stub, account); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	fmt.Println("Account with AccountID", accountID, "has deleted.")
+	accrual, err := postInterest(stub, &account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = credit(&account, currency, depositAmount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = postJournal(stub, "deposit", accountNumber,
+		debitLine("CASH:"+account.Bank, currency, depositAmount),
+		creditLine(accountNumber, currency, depositAmount))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	revenue, err := chargeFee(stub, &account, "deposit", depositAmount, currency, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventDeposit, AccountNumber: accountNumber, Currency: currency, Amount: depositAmount, NewBalance: account.Balances[currency],
+		Interest: accrual.Interest, Fee: revenue.Amount, Changes: balanceChanges(revenue)})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	fmt.Println("=============== End Delete Account ===============")
+	fmt.Println(depositAmount, currency, "has been added to account", accountNumber)
+	fmt.Println("=============== End Deposit ===============")
 	return shim.Success(nil)
 }
 
-func (smartcontract *SmartContract) deposit(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	fmt.Println("=============== Start Deposit ===============")
+func (smartcontract *SmartContract) withdraw(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Withdraw ===============")
 
-	if len(args) != 2 {
+	if len(args) != 3 {
 		return shim.Error("Invalid number of args")
 	}
 
-	accountID := args[0]
-	depositAmountAsString := args[1]
-	depositAmount, _ := strconv.Atoi(depositAmountAsString)
+	accountNumber := args[0]
+	withdrawAmount, err := parsePositiveAmount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	currency := args[2]
+	if err := validateCurrency(currency); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	accountByBytes, err := stub.GetState(accountID)
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwnerOrBankAdmin(stub, account); err != nil {
+		return shim.Error(err.Error())
+	}
 
+	accrual, err := postInterest(stub, &account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = recordOutflow(stub, &account, withdrawAmount, currency)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = debit(&account, currency, withdrawAmount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = postJournal(stub, "withdraw", accountNumber,
+		debitLine(accountNumber, currency, withdrawAmount),
+		creditLine("CASH:"+account.Bank, currency, withdrawAmount))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	revenue, err := chargeFee(stub, &account, "withdraw", withdrawAmount, currency, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventWithdrawal, AccountNumber: accountNumber, Currency: currency, Amount: withdrawAmount, NewBalance: account.Balances[currency],
+		Interest: accrual.Interest, Fee: revenue.Amount, Changes: balanceChanges(revenue)})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	account := Account{}
-	json.Unmarshal(accountByBytes, &account)
-	account.Amount += depositAmount
-	accountAsBytes, _ := json.Marshal(account)
-	err = stub.PutState("ACCOUNT"+account.AccountNumber, accountAsBytes)
+	fmt.Println(withdrawAmount, currency, "has been withdrawn from account", accountNumber)
+	fmt.Println("=============== End Withdraw ===============")
+	return shim.Success(nil)
+}
 
-	fmt.Println(depositAmount, "has been added to account", accountID)
+func (smartcontract *SmartContract) setOverdraftLimit(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Set Overdraft Limit ===============")
 
+	if len(args) != 2 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountNumber := args[0]
+	overdraftLimit, err := money.Parse(args[1])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	fmt.Println("=============== End Deposit ===============")
+	if overdraftLimit < 0 {
+		return shim.Error("Overdraft limit cannot be negative")
+	}
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireBankAdmin(stub, account.Bank); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Lowering the limit below the current debt would leave the account
+	// in a state no withdrawal could have produced.
+	if account.Balances[account.Currency]+overdraftLimit < 0 {
+		return shim.Error("Account " + accountNumber + " is already overdrawn beyond the new limit")
+	}
+
+	account.OverdraftLimit = overdraftLimit
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Overdraft limit of account", accountNumber, "set to", overdraftLimit)
+	fmt.Println("=============== End Set Overdraft Limit ===============")
 	return shim.Success(nil)
 }
 
 func (smartcontract *SmartContract) getHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	historyInterface, _ := stub.GetHistoryForKey(args[0])
-	historyInterface.Close()
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	historyInterface, err := stub.GetHistoryForKey(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer historyInterface.Close()
 
 	for historyInterface.HasNext() {
 		queryResponse, err := historyInterface.Next()
@@ -240,9 +511,273 @@ func (smartcontract *SmartContract) getHistory(stub shim.ChaincodeStubInterface,
 	return shim.Success(nil)
 }
 
-/*
-
 func (smartcontract *SmartContract) transfer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Transfer ===============")
+
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Invalid number of args")
+	}
+
+	fromAccountNumber := args[0]
+	toAccountNumber := args[1]
+	transferAmount, err := parsePositiveAmount(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	currency := args[3]
+	// The receiving side is credited in the same currency unless a
+	// different one is named, in which case the on-ledger rate applies.
+	creditCurrency := currency
+	if len(args) == 5 {
+		creditCurrency = args[4]
+	}
+	if err := validateCurrency(currency); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateCurrency(creditCurrency); err != nil {
+		return shim.Error(err.Error())
+	}
+	if fromAccountNumber == toAccountNumber {
+		return shim.Error("Cannot transfer to the same account")
+	}
+
+	from, err := getAccount(stub, fromAccountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwnerOrBankAdmin(stub, from); err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := getAccount(stub, toAccountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = recordOutflow(stub, &from, transferAmount, currency)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receipt, err := moveFunds(stub, &from, &to, transferAmount, currency, creditCurrency, from.AccountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	revenue, err := chargeFee(stub, &from, "transfer", transferAmount, currency, fromAccountNumber, &to)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receipt.Fee = revenue.Amount
+	receipt.FromBalance = from.Balances[currency]
+	receipt.ToBalance = to.Balances[creditCurrency]
+
+	if err := putAccount(stub, from); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putAccount(stub, to); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	receiptAsBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{
+		Type:                 EventTransfer,
+		AccountNumber:        fromAccountNumber,
+		Currency:             currency,
+		Amount:               transferAmount,
+		NewBalance:           receipt.FromBalance,
+		Counterparty:         toAccountNumber,
+		CounterpartyCurrency: creditCurrency,
+		CounterpartyAmount:   receipt.CreditAmount,
+		CounterpartyBalance:  receipt.ToBalance,
+		CounterpartyInterest: receipt.ToInterest,
+		Interest:             receipt.FromInterest,
+		Fee:                  receipt.Fee,
+		Changes:              balanceChanges(revenue),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println(transferAmount, currency, "has been transferred from account", fromAccountNumber, "to account", toAccountNumber, "as", receipt.CreditAmount, creditCurrency)
+	fmt.Println("=============== End Transfer ===============")
+	return shim.Success(receiptAsBytes)
+}
+
+// moveFunds debits amount in currency from one account and credits the
+// converted amount in creditCurrency to the other, recording an interbank
+// obligation under reference when the banks differ. Interest owed on both
+// accounts is posted first, so each balance only earns for the time it was
+// held. Spending limits are not checked here, so callers that move the
+// owner's money must call recordOutflow first. Both accounts are only
+// changed in memory, and apart from that interest are left untouched if the
+// move fails; the caller stores them.
+func moveFunds(stub shim.ChaincodeStubInterface, from *Account, to *Account, amount money.Amount, currency string, creditCurrency string, reference string) (TransferReceipt, error) {
+	receipt := TransferReceipt{
+		TxID:           stub.GetTxID(),
+		From:           from.AccountNumber,
+		To:             to.AccountNumber,
+		Currency:       currency,
+		Amount:         amount,
+		CreditCurrency: creditCurrency,
+	}
+
+	creditAmount, err := convertAmount(stub, amount, currency, creditCurrency)
+	if err != nil {
+		return receipt, err
+	}
+	// Conversion truncates, so a tiny amount can round down to nothing on
+	// the receiving side; refuse rather than debit for no credit.
+	if creditAmount <= 0 {
+		return receipt, fmt.Errorf("%s %s is too small to convert to %s", amount, currency, creditCurrency)
+	}
+	receipt.CreditAmount = creditAmount
+
+	fromAccrual, err := postInterest(stub, from)
+	if err != nil {
+		return receipt, err
+	}
+	receipt.FromInterest = fromAccrual.Interest
+	toAccrual, err := postInterest(stub, to)
+	if err != nil {
+		return receipt, err
+	}
+	receipt.ToInterest = toAccrual.Interest
+
+	fromBalance := from.Balances[currency]
+	err = debit(from, currency, amount)
+	if err != nil {
+		return receipt, err
+	}
+	err = credit(to, creditCurrency, creditAmount)
+	if err != nil {
+		from.Balances[currency] = fromBalance
+		return receipt, err
+	}
+
+	if from.Bank != to.Bank {
+		err = recordObligation(stub, reference, from.Bank, to.Bank, creditCurrency, creditAmount)
+		if err != nil {
+			return receipt, err
+		}
+	}
+
+	// A conversion is booked through the sending bank's FX account so that
+	// each currency balances on its own.
+	lines := []JournalLine{debitLine(from.AccountNumber, currency, amount)}
+	if creditCurrency != currency {
+		lines = append(lines,
+			creditLine("FX:"+from.Bank, currency, amount),
+			debitLine("FX:"+from.Bank, creditCurrency, creditAmount))
+	}
+	lines = append(lines, creditLine(to.AccountNumber, creditCurrency, creditAmount))
+	err = postJournal(stub, "transfer", reference, lines...)
+	if err != nil {
+		return receipt, err
+	}
+
+	receipt.FromBalance = from.Balances[currency]
+	receipt.ToBalance = to.Balances[creditCurrency]
+	return receipt, nil
+}
+
+// getAccount loads the account stored under ACCOUNT<accountNumber>
+func getAccount(stub shim.ChaincodeStubInterface, accountNumber string) (Account, error) {
+	account := Account{}
+
+	accountAsBytes, err := stub.GetState("ACCOUNT" + accountNumber)
+	if err != nil {
+		return account, err
+	}
+	if accountAsBytes == nil {
+		return account, fmt.Errorf("Account %s does not exist", accountNumber)
+	}
+
+	err = json.Unmarshal(accountAsBytes, &account)
+	if account.Balances == nil {
+		account.Balances = map[string]money.Amount{}
+	}
+	if account.Status == "" {
+		account.Status = StatusActive
+	}
+	return account, err
+}
+
+// putAccount stores the account under ACCOUNT<AccountNumber>
+func putAccount(stub shim.ChaincodeStubInterface, account Account) error {
+	accountAsBytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return stub.PutState("ACCOUNT"+account.AccountNumber, accountAsBytes)
+}
+
+// getTxTime returns the transaction timestamp, which every endorser sees
+// identically, as a UTC time
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// parsePositiveAmount parses a money amount argument and rejects zero or
+// negative values
+func parsePositiveAmount(amountAsString string) (money.Amount, error) {
+	amount, err := money.Parse(amountAsString)
+	if err != nil {
+		return 0, err
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("Amount must be positive")
+	}
+	return amount, nil
+}
+
+// credit adds amount to the account's balance in currency
+func credit(account *Account, currency string, amount money.Amount) error {
+	if account.Status != StatusActive {
+		return fmt.Errorf("Account %s is %s", account.AccountNumber, account.Status)
+	}
+
+	balance, err := account.Balances[currency].Add(amount)
+	if err != nil {
+		return err
+	}
+	account.Balances[currency] = balance
+	return nil
+}
+
+// debit takes amount from the account's balance in currency unless that
+// would push the available balance, i.e. the balance less any holds, below
+// its floor. Only the home currency may be overdrawn.
+func debit(account *Account, currency string, amount money.Amount) error {
+	if account.Status != StatusActive {
+		return fmt.Errorf("Account %s is %s", account.AccountNumber, account.Status)
+	}
+
+	balance, err := account.Balances[currency].Sub(amount)
+	if err != nil {
+		return err
+	}
+	held, err := heldAmount(*account, currency)
+	if err != nil {
+		return err
+	}
+	available, err := balance.Sub(held)
+	if err != nil {
+		return err
+	}
+
+	floor := money.Amount(0)
+	if currency == account.Currency {
+		floor = -account.OverdraftLimit
+	}
+	if available < floor {
+		return fmt.Errorf("Insufficient %s balance in account %s", currency, account.AccountNumber)
+	}
 
+	account.Balances[currency] = balance
+	return nil
 }
-*/
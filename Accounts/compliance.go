@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// Account statuses. Only active accounts can send or receive money.
+const (
+	StatusActive = "active"
+	StatusFrozen = "frozen"
+	StatusClosed = "closed"
+)
+
+// Hold reserves Amount of a balance, reducing what can be debited without
+// moving any funds
+type Hold struct {
+	HoldID   string       `json:"HoldID"`
+	Currency string       `json:"Currency"`
+	Amount   money.Amount `json:"Amount"`
+	Reason   string       `json:"Reason"`
+	TxID     string       `json:"TxID"`
+}
+
+func (smartcontract *SmartContract) freezeAccount(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Freeze Account ===============")
+
+	if len(args) != 2 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireComplianceOfficer(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	accountNumber := args[0]
+	reason := args[1]
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if account.Status != StatusActive {
+		return shim.Error("Account " + accountNumber + " is " + account.Status)
+	}
+
+	account.Status = StatusFrozen
+	account.StatusReason = reason
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventAccountFrozen, AccountNumber: accountNumber, Currency: account.Currency, NewBalance: account.Balances[account.Currency]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Account", accountNumber, "has been frozen:", reason)
+	fmt.Println("=============== End Freeze Account ===============")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) unfreezeAccount(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Unfreeze Account ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireComplianceOfficer(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	accountNumber := args[0]
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if account.Status != StatusFrozen {
+		return shim.Error("Account " + accountNumber + " is not frozen")
+	}
+
+	account.Status = StatusActive
+	account.StatusReason = ""
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventAccountUnfrozen, AccountNumber: accountNumber, Currency: account.Currency, NewBalance: account.Balances[account.Currency]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Account", accountNumber, "has been unfrozen")
+	fmt.Println("=============== End Unfreeze Account ===============")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) placeHold(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Place Hold ===============")
+
+	if len(args) != 5 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireComplianceOfficer(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	accountNumber := args[0]
+	holdID := args[1]
+	holdAmount, err := parsePositiveAmount(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	currency := args[3]
+	if err := validateCurrency(currency); err != nil {
+		return shim.Error(err.Error())
+	}
+	reason := args[4]
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if account.Status == StatusClosed {
+		return shim.Error("Account " + accountNumber + " is closed")
+	}
+	for _, hold := range account.Holds {
+		if hold.HoldID == holdID {
+			return shim.Error("Hold " + holdID + " already exists on account " + accountNumber)
+		}
+	}
+
+	account.Holds = append(account.Holds, Hold{HoldID: holdID, Currency: currency, Amount: holdAmount, Reason: reason, TxID: stub.GetTxID()})
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Hold", holdID, "of", holdAmount, currency, "placed on account", accountNumber)
+	fmt.Println("=============== End Place Hold ===============")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) releaseHold(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Release Hold ===============")
+
+	if len(args) != 2 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireComplianceOfficer(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	accountNumber := args[0]
+	holdID := args[1]
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	holds := []Hold{}
+	for _, hold := range account.Holds {
+		if hold.HoldID != holdID {
+			holds = append(holds, hold)
+		}
+	}
+	if len(holds) == len(account.Holds) {
+		return shim.Error("Hold " + holdID + " does not exist on account " + accountNumber)
+	}
+
+	account.Holds = holds
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Hold", holdID, "released on account", accountNumber)
+	fmt.Println("=============== End Release Hold ===============")
+	return shim.Success(nil)
+}
+
+// heldAmount sums the holds on the account in currency
+func heldAmount(account Account, currency string) (money.Amount, error) {
+	held := money.Amount(0)
+	for _, hold := range account.Holds {
+		if hold.Currency != currency {
+			continue
+		}
+		sum, err := held.Add(hold.Amount)
+		if err != nil {
+			return 0, err
+		}
+		held = sum
+	}
+	return held, nil
+}
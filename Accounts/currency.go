@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// rateDecimals is the number of implied decimal places in ExchangeRate.Rate.
+// Rates are kept as integers so every endorser converts to the same result.
+const rateDecimals = 6
+
+// ExchangeRate says how many units of To one unit of From buys
+type ExchangeRate struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+	Rate int64  `json:"Rate"`
+	TxID string `json:"TxID"`
+}
+
+func (smartcontract *SmartContract) setExchangeRate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Set Exchange Rate ===============")
+
+	if len(args) != 3 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	from := args[0]
+	to := args[1]
+	if err := validateCurrency(from); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateCurrency(to); err != nil {
+		return shim.Error(err.Error())
+	}
+	if from == to {
+		return shim.Error("Exchange rate needs two different currencies")
+	}
+
+	rate, err := parseRate(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	exchangeRate := ExchangeRate{From: from, To: to, Rate: rate, TxID: stub.GetTxID()}
+	exchangeRateAsBytes, err := json.Marshal(exchangeRate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState("RATE"+from+to, exchangeRateAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Exchange rate", from, "->", to, "set to", args[2])
+	fmt.Println("=============== End Set Exchange Rate ===============")
+	return shim.Success(exchangeRateAsBytes)
+}
+
+func (smartcontract *SmartContract) queryExchangeRate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Exchange Rate ===============")
+
+	if len(args) != 2 {
+		return shim.Error("Invalid number of args")
+	}
+
+	exchangeRateAsBytes, err := stub.GetState("RATE" + args[0] + args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if exchangeRateAsBytes == nil {
+		return shim.Error("No exchange rate from " + args[0] + " to " + args[1])
+	}
+
+	fmt.Println("=============== End Query Exchange Rate ===============")
+	return shim.Success(exchangeRateAsBytes)
+}
+
+// convertAmount converts amount from one currency into another using the
+// rate stored on the ledger, truncating any fraction of the smallest unit.
+// Only the direct rate is used; the inverse pair must be set separately.
+func convertAmount(stub shim.ChaincodeStubInterface, amount money.Amount, from string, to string) (money.Amount, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	exchangeRateAsBytes, err := stub.GetState("RATE" + from + to)
+	if err != nil {
+		return 0, err
+	}
+	if exchangeRateAsBytes == nil {
+		return 0, fmt.Errorf("No exchange rate from %s to %s", from, to)
+	}
+
+	exchangeRate := ExchangeRate{}
+	err = json.Unmarshal(exchangeRateAsBytes, &exchangeRate)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount.MulRate(exchangeRate.Rate, rateDecimals)
+}
+
+// parseRate parses a positive decimal such as "1.0834" into a fixed-point
+// integer with rateDecimals decimal places
+func parseRate(rateAsString string) (int64, error) {
+	parts := strings.SplitN(rateAsString, ".", 2)
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	if len(fraction) > rateDecimals {
+		return 0, fmt.Errorf("Rate %s has more than %d decimal places", rateAsString, rateDecimals)
+	}
+	digits := parts[0] + fraction + strings.Repeat("0", rateDecimals-len(fraction))
+	if strings.ContainsAny(digits, "+-") {
+		return 0, fmt.Errorf("Rate %s is not a valid decimal", rateAsString)
+	}
+
+	rate, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Rate %s is not a valid decimal", rateAsString)
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("Rate must be positive")
+	}
+	return rate, nil
+}
+
+// parseNonNegativeRate is like parseRate but also accepts "0"
+func parseNonNegativeRate(rateAsString string) (int64, error) {
+	if rateAsString == "0" {
+		return 0, nil
+	}
+	return parseRate(rateAsString)
+}
+
+// validateCurrency checks that code looks like an ISO-4217 alphabetic code
+func validateCurrency(code string) error {
+	if len(code) != 3 {
+		return fmt.Errorf("Currency %s is not a three letter ISO-4217 code", code)
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return fmt.Errorf("Currency %s is not a three letter ISO-4217 code", code)
+		}
+	}
+	return nil
+}
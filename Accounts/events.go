@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// Account event types, also used as the chaincode event name so listeners
+// can filter on them
+const (
+	EventAccountCreated  = "accountCreated"
+	EventDeposit         = "deposit"
+	EventWithdrawal      = "withdrawal"
+	EventTransfer        = "transfer"
+	EventAccountFrozen   = "accountFrozen"
+	EventAccountUnfrozen = "accountUnfrozen"
+	EventAccountClosed   = "accountClosed"
+	EventInterestAccrued = "interestAccrued"
+	// EventStandingOrdersExecuted has a StandingOrdersEvent payload
+	EventStandingOrdersExecuted = "standingOrdersExecuted"
+)
+
+// AccountEvent is the payload of the account chaincode events. Amount and
+// NewBalance are in Currency; NewBalance includes any Interest posted to
+// the account before the operation and is net of the Fee it paid. For
+// transfers the receiving side is described by the Counterparty fields.
+// Changes lists the other balances the transaction changed, such as the
+// bank's revenue account receiving the fee.
+type AccountEvent struct {
+	Type                 string          `json:"Type"`
+	AccountNumber        string          `json:"AccountNumber"`
+	Currency             string          `json:"Currency"`
+	Amount               money.Amount    `json:"Amount"`
+	NewBalance           money.Amount    `json:"NewBalance"`
+	TxID                 string          `json:"TxID"`
+	Counterparty         string          `json:"Counterparty,omitempty"`
+	CounterpartyCurrency string          `json:"CounterpartyCurrency,omitempty"`
+	CounterpartyAmount   money.Amount    `json:"CounterpartyAmount,omitempty"`
+	CounterpartyBalance  money.Amount    `json:"CounterpartyBalance,omitempty"`
+	CounterpartyInterest money.Amount    `json:"CounterpartyInterest,omitempty"`
+	Interest             money.Amount    `json:"Interest,omitempty"`
+	Fee                  money.Amount    `json:"Fee,omitempty"`
+	Changes              []BalanceChange `json:"Changes,omitempty"`
+}
+
+// BalanceChange is one balance changed by a transaction. Amount is
+// negative for a debit.
+type BalanceChange struct {
+	AccountNumber string       `json:"AccountNumber"`
+	Currency      string       `json:"Currency"`
+	Reason        string       `json:"Reason"`
+	Amount        money.Amount `json:"Amount"`
+	NewBalance    money.Amount `json:"NewBalance"`
+}
+
+// StandingOrdersEvent reports every run of one executeDueOrders call with
+// the resulting balances of all the accounts the runs touched, including
+// interest posted on them
+type StandingOrdersEvent struct {
+	Type     string           `json:"Type"`
+	TxID     string           `json:"TxID"`
+	Runs     []OrderRun       `json:"Runs"`
+	Balances []AccountBalance `json:"Balances"`
+}
+
+// emitAccountEvent sets the event for the transaction. Fabric keeps only one
+// event per transaction, so each function emits at most one.
+func emitAccountEvent(stub shim.ChaincodeStubInterface, event AccountEvent) error {
+	event.TxID = stub.GetTxID()
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(event.Type, eventAsBytes)
+}
+
+// emitStandingOrdersEvent sets the event for an executeDueOrders transaction
+func emitStandingOrdersEvent(stub shim.ChaincodeStubInterface, event StandingOrdersEvent) error {
+	event.Type = EventStandingOrdersExecuted
+	event.TxID = stub.GetTxID()
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(event.Type, eventAsBytes)
+}
+
+// balanceChanges drops the changes that moved nothing
+func balanceChanges(changes ...BalanceChange) []BalanceChange {
+	nonzero := []BalanceChange{}
+	for _, change := range changes {
+		if change.Amount != 0 {
+			nonzero = append(nonzero, change)
+		}
+	}
+	return nonzero
+}
+
+// accrualChange describes an interest posting as a balance change
+func accrualChange(entry AccrualEntry) BalanceChange {
+	return BalanceChange{AccountNumber: entry.AccountNumber, Currency: entry.Currency, Reason: "interest", Amount: entry.Interest, NewBalance: entry.NewBalance}
+}
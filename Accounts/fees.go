@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// Fee is charged per operation: Flat in the schedule currency plus Percent,
+// fixed-point with rateDecimals decimal places, of the amount moved
+type Fee struct {
+	Flat    money.Amount `json:"Flat"`
+	Percent int64        `json:"Percent"`
+}
+
+// FeeSchedule is stored under FEESCHEDULE~<bank>. Fees are paid into
+// RevenueAccount, and flat fees are in its home currency.
+type FeeSchedule struct {
+	Bank           string         `json:"Bank"`
+	RevenueAccount string         `json:"RevenueAccount"`
+	Currency       string         `json:"Currency"`
+	Fees           map[string]Fee `json:"Fees"`
+}
+
+// FeeEntry records one fee, under FEE~<bank>~<time>~<txID>~<reference>,
+// where the reference is the account number except for standing orders
+type FeeEntry struct {
+	Bank          string       `json:"Bank"`
+	Operation     string       `json:"Operation"`
+	AccountNumber string       `json:"AccountNumber"`
+	Currency      string       `json:"Currency"`
+	Amount        money.Amount `json:"Amount"`
+	TxID          string       `json:"TxID"`
+	Time          time.Time    `json:"Time"`
+}
+
+// FeeReport lists the fees a bank collected in a period with totals per
+// currency
+type FeeReport struct {
+	Bank    string                  `json:"Bank"`
+	From    time.Time               `json:"From"`
+	To      time.Time               `json:"To"`
+	Totals  map[string]money.Amount `json:"Totals"`
+	Entries []FeeEntry              `json:"Entries"`
+}
+
+// setFee takes the bank, its revenue account number, the operation
+// (deposit, withdraw or transfer), the flat fee and the percentage as a
+// fraction such as "0.001"
+func (smartcontract *SmartContract) setFee(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Set Fee ===============")
+
+	if len(args) != 5 {
+		return shim.Error("Invalid number of args")
+	}
+
+	bank := args[0]
+	revenueAccountNumber := args[1]
+	operation := args[2]
+	if operation != "deposit" && operation != "withdraw" && operation != "transfer" {
+		return shim.Error("Operation must be deposit, withdraw or transfer")
+	}
+	flat, err := money.Parse(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if flat < 0 {
+		return shim.Error("Flat fee cannot be negative")
+	}
+	percent, err := parseNonNegativeRate(args[4])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := requireBankAdmin(stub, bank); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	revenueAccount, err := getAccount(stub, revenueAccountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if revenueAccount.Bank != bank {
+		return shim.Error("Revenue account " + revenueAccountNumber + " does not belong to bank " + bank)
+	}
+
+	schedule, err := getFeeSchedule(stub, bank)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if schedule == nil {
+		schedule = &FeeSchedule{Bank: bank, Fees: map[string]Fee{}}
+	}
+	// Flat fees already set are in the old revenue account's currency.
+	if schedule.Currency != "" && schedule.Currency != revenueAccount.Currency && len(schedule.Fees) > 0 {
+		return shim.Error("Revenue account currency differs from the currency of the existing fees")
+	}
+	schedule.RevenueAccount = revenueAccountNumber
+	schedule.Currency = revenueAccount.Currency
+	schedule.Fees[operation] = Fee{Flat: flat, Percent: percent}
+
+	scheduleAsBytes, err := json.Marshal(schedule)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	scheduleKey, err := stub.CreateCompositeKey("FEESCHEDULE", []string{bank})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(scheduleKey, scheduleAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println(operation, "fee of bank", bank, "set to", flat, schedule.Currency, "plus", args[4])
+	fmt.Println("=============== End Set Fee ===============")
+	return shim.Success(scheduleAsBytes)
+}
+
+func (smartcontract *SmartContract) queryFeeSchedule(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Fee Schedule ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	schedule, err := getFeeSchedule(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if schedule == nil {
+		return shim.Error("Bank " + args[0] + " has no fee schedule")
+	}
+	scheduleAsBytes, err := json.Marshal(schedule)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Query Fee Schedule ===============")
+	return shim.Success(scheduleAsBytes)
+}
+
+// queryFeesCollected takes the bank and the RFC3339 start and end of the
+// period, both inclusive
+func (smartcontract *SmartContract) queryFeesCollected(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Fees Collected ===============")
+
+	if len(args) != 3 {
+		return shim.Error("Invalid number of args")
+	}
+
+	bank := args[0]
+	from, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("FEE", []string{bank})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	report := FeeReport{Bank: bank, From: from.UTC(), To: to.UTC(), Totals: map[string]money.Amount{}, Entries: []FeeEntry{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entry := FeeEntry{}
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if entry.Time.Before(from) || entry.Time.After(to) {
+			continue
+		}
+
+		report.Totals[entry.Currency], err = report.Totals[entry.Currency].Add(entry.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Query Fees Collected ===============")
+	return shim.Success(reportAsBytes)
+}
+
+// feeFor returns the fee the payer's bank charges for operation on amount
+// in currency, in that currency, with the bank's schedule. The fee is zero
+// when the bank charges none. A bank does not charge its own revenue
+// account.
+func feeFor(stub shim.ChaincodeStubInterface, payer Account, operation string, amount money.Amount, currency string) (money.Amount, *FeeSchedule, error) {
+	schedule, err := getFeeSchedule(stub, payer.Bank)
+	if err != nil || schedule == nil {
+		return 0, nil, err
+	}
+	fee, ok := schedule.Fees[operation]
+	if !ok || schedule.RevenueAccount == payer.AccountNumber {
+		return 0, schedule, nil
+	}
+
+	// A percentage-only fee needs no rate, so operations in currencies
+	// without one are not blocked by it.
+	flat := fee.Flat
+	if flat != 0 {
+		flat, err = convertAmount(stub, fee.Flat, schedule.Currency, currency)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	percentage, err := amount.MulRate(fee.Percent, rateDecimals)
+	if err != nil {
+		return 0, nil, err
+	}
+	total, err := flat.Add(percentage)
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, schedule, nil
+}
+
+// chargeFee debits the fee the payer's bank charges for operation on amount
+// in currency, credits it to the bank's revenue account and records it. The
+// fee is in the operation's currency. reference tells the fee apart from
+// others charged in the same transaction; single operations pass the payer's
+// account number. loaded lists other accounts the caller holds in memory and
+// will store; if the revenue account is one of them it is credited there,
+// otherwise it is read and stored here. The returned change is the credit to
+// the revenue account, whose Amount is the fee; it is zero if no fee was
+// due.
+func chargeFee(stub shim.ChaincodeStubInterface, payer *Account, operation string, amount money.Amount, currency string, reference string, loaded ...*Account) (BalanceChange, error) {
+	total, schedule, err := feeFor(stub, *payer, operation, amount, currency)
+	if err != nil || total == 0 {
+		return BalanceChange{}, err
+	}
+
+	var revenueAccount *Account
+	for _, account := range loaded {
+		if account.AccountNumber == schedule.RevenueAccount {
+			revenueAccount = account
+		}
+	}
+	storeRevenueAccount := revenueAccount == nil
+	if storeRevenueAccount {
+		account, err := getAccount(stub, schedule.RevenueAccount)
+		if err != nil {
+			return BalanceChange{}, err
+		}
+		revenueAccount = &account
+	}
+
+	// The revenue account earns interest on its balance like any other
+	_, err = postInterest(stub, revenueAccount)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	err = debit(payer, currency, total)
+	if err != nil {
+		return BalanceChange{}, fmt.Errorf("Cannot pay %s fee: %s", operation, err)
+	}
+	err = credit(revenueAccount, currency, total)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	if storeRevenueAccount {
+		err = putAccount(stub, *revenueAccount)
+		if err != nil {
+			return BalanceChange{}, err
+		}
+	}
+	err = postJournal(stub, "fee", reference,
+		debitLine(payer.AccountNumber, currency, total),
+		creditLine(revenueAccount.AccountNumber, currency, total))
+	if err != nil {
+		return BalanceChange{}, err
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	entry := FeeEntry{Bank: payer.Bank, Operation: operation, AccountNumber: payer.AccountNumber, Currency: currency, Amount: total, TxID: stub.GetTxID(), Time: now}
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	entryKey, err := stub.CreateCompositeKey("FEE", []string{entry.Bank, now.Format(time.RFC3339Nano), entry.TxID, reference})
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	err = stub.PutState(entryKey, entryAsBytes)
+	if err != nil {
+		return BalanceChange{}, err
+	}
+	return BalanceChange{AccountNumber: revenueAccount.AccountNumber, Currency: currency, Reason: "fee", Amount: total, NewBalance: revenueAccount.Balances[currency]}, nil
+}
+
+// getFeeSchedule loads the bank's fee schedule, or nil if it has none
+func getFeeSchedule(stub shim.ChaincodeStubInterface, bank string) (*FeeSchedule, error) {
+	scheduleKey, err := stub.CreateCompositeKey("FEESCHEDULE", []string{bank})
+	if err != nil {
+		return nil, err
+	}
+	scheduleAsBytes, err := stub.GetState(scheduleKey)
+	if err != nil || scheduleAsBytes == nil {
+		return nil, err
+	}
+
+	schedule := FeeSchedule{}
+	err = json.Unmarshal(scheduleAsBytes, &schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// Index names. Index entries are composite keys of the indexed value and
+// the account number, stored with a single null byte as value.
+const (
+	bankIndex  = "bank~account"
+	ownerIndex = "name~account"
+)
+
+func (smartcontract *SmartContract) queryAccountsByBank(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Accounts By Bank ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountsAsBytes, err := queryAccountsByIndex(stub, bankIndex, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Query Accounts By Bank ===============")
+	return shim.Success(accountsAsBytes)
+}
+
+func (smartcontract *SmartContract) queryAccountsByOwner(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Accounts By Owner ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountsAsBytes, err := queryAccountsByIndex(stub, ownerIndex, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Query Accounts By Owner ===============")
+	return shim.Success(accountsAsBytes)
+}
+
+// queryAccountsByIndex returns a JSON array of the accounts listed under
+// value in the given index
+func queryAccountsByIndex(stub shim.ChaincodeStubInterface, index string, value string) ([]byte, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(index, []string{value})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		accountAsBytes, err := stub.GetState("ACCOUNT" + attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if accountAsBytes == nil {
+			continue
+		}
+
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(accountAsBytes)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	return buffer.Bytes(), nil
+}
+
+// putAccountIndexes adds the account to the bank and owner name indexes
+func putAccountIndexes(stub shim.ChaincodeStubInterface, account Account) error {
+	bankKey, err := stub.CreateCompositeKey(bankIndex, []string{account.Bank, account.AccountNumber})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(bankKey, []byte{0x00})
+	if err != nil {
+		return err
+	}
+
+	ownerKey, err := stub.CreateCompositeKey(ownerIndex, []string{account.FirstName, account.AccountNumber})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(ownerKey, []byte{0x00})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// secondsPerYear is the day count basis used for interest (actual/365)
+const secondsPerYear = 365 * 24 * 60 * 60
+
+// maxClockSkew is how far ahead of the endorsing peer's clock a
+// transaction that posts interest may be timestamped. Clients choose the
+// timestamp, and one from the future would pay interest for time that has
+// not passed.
+const maxClockSkew = 5 * time.Minute
+
+// AccrualEntry records one interest posting so it can be recomputed later
+type AccrualEntry struct {
+	AccountNumber string       `json:"AccountNumber"`
+	Currency      string       `json:"Currency"`
+	Balance       money.Amount `json:"Balance"`
+	InterestRate  int64        `json:"InterestRate"`
+	From          time.Time    `json:"From"`
+	To            time.Time    `json:"To"`
+	Interest      money.Amount `json:"Interest"`
+	NewBalance    money.Amount `json:"NewBalance"`
+	TxID          string       `json:"TxID"`
+}
+
+func (smartcontract *SmartContract) setInterestRate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Set Interest Rate ===============")
+
+	if len(args) != 2 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	accountNumber := args[0]
+	interestRate, err := parseNonNegativeRate(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if account.Status != StatusActive {
+		return shim.Error("Account " + accountNumber + " is " + account.Status)
+	}
+
+	// Interest up to now is owed at the old rate, so post it before the
+	// new rate takes effect.
+	entry, err := postInterest(stub, &account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	account.InterestRate = interestRate
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if entry.Interest != 0 {
+		err = emitAccountEvent(stub, AccountEvent{Type: EventInterestAccrued, AccountNumber: accountNumber, Currency: entry.Currency, Amount: entry.Interest, NewBalance: entry.NewBalance, Interest: entry.Interest})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("Interest rate of account", accountNumber, "set to", args[1])
+	fmt.Println("=============== End Set Interest Rate ===============")
+	return shim.Success(nil)
+}
+
+// accrueInterest may be called by anyone: the result only depends on the
+// ledger and the transaction timestamp, so every endorser agrees on it.
+// Timestamps before the last accrual are refused, as postInterest refuses
+// those ahead of the peer's clock.
+func (smartcontract *SmartContract) accrueInterest(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Accrue Interest ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	account, err := getAccount(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Before(account.LastAccrual) {
+		return shim.Error("Transaction timestamp is before the last accrual of account " + account.AccountNumber)
+	}
+
+	entry, err := postInterest(stub, &account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventInterestAccrued, AccountNumber: account.AccountNumber, Currency: entry.Currency, Amount: entry.Interest, NewBalance: entry.NewBalance, Interest: entry.Interest})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println(entry.Interest, entry.Currency, "interest accrued on account", account.AccountNumber)
+	fmt.Println("=============== End Accrue Interest ===============")
+	return shim.Success(entryAsBytes)
+}
+
+func (smartcontract *SmartContract) getAccruals(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Get Accruals ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("ACCRUAL", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResponse.Value)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Println("=============== End Get Accruals ===============")
+	return shim.Success(buffer.Bytes())
+}
+
+// postInterest credits simple interest on the home currency balance for the
+// time between LastAccrual and the transaction timestamp. Every balance
+// change posts interest first, so the balance used has been held for the
+// whole period; it is kept on the entry. It also stores an AccrualEntry
+// under ACCRUAL~<account>~<txID>. Negative balances earn nothing. Interest
+// is credited in whole cents and the rest is kept in InterestCarry for the
+// next period. Nothing is posted while the account is not active; the
+// interest is caught up once it is. Timestamps ahead of the peer's clock
+// are refused, see requireTxTimeNotAhead. The caller must store the account
+// afterwards.
+func postInterest(stub shim.ChaincodeStubInterface, account *Account) (AccrualEntry, error) {
+	now, err := getTxTime(stub)
+	if err != nil {
+		return AccrualEntry{}, err
+	}
+	if err := requireTxTimeNotAhead(now); err != nil {
+		return AccrualEntry{}, err
+	}
+
+	entry := AccrualEntry{
+		AccountNumber: account.AccountNumber,
+		Currency:      account.Currency,
+		Balance:       account.Balances[account.Currency],
+		InterestRate:  account.InterestRate,
+		From:          account.LastAccrual,
+		To:            now,
+		NewBalance:    account.Balances[account.Currency],
+		TxID:          stub.GetTxID(),
+	}
+
+	if account.LastAccrual.IsZero() || account.InterestRate == 0 || entry.Balance <= 0 {
+		// LastAccrual never moves back, so an old timestamp cannot earn
+		// the same period twice
+		if now.After(account.LastAccrual) {
+			account.LastAccrual = now
+		}
+		return entry, nil
+	}
+	if account.Status != StatusActive || !now.After(account.LastAccrual) {
+		return entry, nil
+	}
+
+	elapsed := int64(now.Sub(account.LastAccrual) / time.Second)
+	interest := new(big.Int).Mul(big.NewInt(int64(entry.Balance)), big.NewInt(account.InterestRate))
+	interest.Mul(interest, big.NewInt(elapsed))
+	interest.Add(interest, big.NewInt(account.InterestCarry))
+	carry := new(big.Int)
+	interest.QuoRem(interest, new(big.Int).Mul(big.NewInt(secondsPerYear), new(big.Int).Exp(big.NewInt(10), big.NewInt(rateDecimals), nil)), carry)
+	if !interest.IsInt64() {
+		return entry, money.ErrOverflow
+	}
+	entry.Interest = money.Amount(interest.Int64())
+
+	err = credit(account, account.Currency, entry.Interest)
+	if err != nil {
+		return entry, err
+	}
+	account.LastAccrual = now
+	account.InterestCarry = carry.Int64()
+	if entry.Interest == 0 {
+		return entry, nil
+	}
+	entry.NewBalance = account.Balances[account.Currency]
+
+	err = postJournal(stub, "interest", account.AccountNumber,
+		debitLine("INTEREST:"+account.Bank, account.Currency, entry.Interest),
+		creditLine(account.AccountNumber, account.Currency, entry.Interest))
+	if err != nil {
+		return entry, err
+	}
+
+	entryKey, err := stub.CreateCompositeKey("ACCRUAL", []string{account.AccountNumber, entry.TxID})
+	if err != nil {
+		return entry, err
+	}
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	return entry, stub.PutState(entryKey, entryAsBytes)
+}
+
+// requireTxTimeNotAhead refuses transaction times more than maxClockSkew
+// ahead of the endorsing peer's clock. Reading the peer's clock is a
+// deliberate exception to deterministic endorsement: it only decides
+// whether to endorse, never what is written, so peers that disagree near
+// the edge fail the endorsement policy instead of writing different state.
+func requireTxTimeNotAhead(now time.Time) error {
+	if now.After(time.Now().Add(maxClockSkew)) {
+		return fmt.Errorf("Transaction timestamp is in the future")
+	}
+	return nil
+}
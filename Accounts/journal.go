@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// JournalLine debits or credits one ledger account. Customer accounts are
+// named by account number; the bank's own books use CASH:<bank> for money
+// entering or leaving the network, INTEREST:<bank> for interest paid and
+// FX:<bank> to balance currency conversions. Customer balances are
+// liabilities, so a credit raises a balance and a debit lowers it.
+type JournalLine struct {
+	Account  string       `json:"Account"`
+	Currency string       `json:"Currency"`
+	Debit    money.Amount `json:"Debit"`
+	Credit   money.Amount `json:"Credit"`
+}
+
+// JournalEntry is stored under JOURNAL~<txID>~<kind>~<reference>. Its
+// debits and credits are equal in every currency.
+type JournalEntry struct {
+	TxID      string        `json:"TxID"`
+	Time      time.Time     `json:"Time"`
+	Kind      string        `json:"Kind"`
+	Reference string        `json:"Reference"`
+	Lines     []JournalLine `json:"Lines"`
+}
+
+// CurrencyTotals sums all journal lines in one currency
+type CurrencyTotals struct {
+	Debits   money.Amount `json:"Debits"`
+	Credits  money.Amount `json:"Credits"`
+	Balanced bool         `json:"Balanced"`
+}
+
+// AccountBalance is the net of an account's journal lines, credits less
+// debits, in one currency
+type AccountBalance struct {
+	Account  string       `json:"Account"`
+	Currency string       `json:"Currency"`
+	Balance  money.Amount `json:"Balance"`
+}
+
+// BalanceDifference is a customer account whose stored balance in one
+// currency is not the net of its journal lines. Difference is Stored less
+// Journal; an account opened before the journal existed differs by its
+// balance at the time.
+type BalanceDifference struct {
+	Account    string       `json:"Account"`
+	Currency   string       `json:"Currency"`
+	Stored     money.Amount `json:"Stored"`
+	Journal    money.Amount `json:"Journal"`
+	Difference money.Amount `json:"Difference"`
+}
+
+// TrialBalance is returned by trialBalance. Balanced is true when every
+// currency balances and, for a trial balance as of now, no account differs
+// from the journal.
+type TrialBalance struct {
+	AsOf        time.Time                 `json:"AsOf"`
+	Balanced    bool                      `json:"Balanced"`
+	Currencies  map[string]CurrencyTotals `json:"Currencies"`
+	Accounts    []AccountBalance          `json:"Accounts"`
+	Reconciled  bool                      `json:"Reconciled"`
+	Differences []BalanceDifference       `json:"Differences"`
+}
+
+// trialBalance sums every journal entry up to an optional RFC3339 time,
+// defaulting to the transaction time. Without a time the journal is also
+// reconciled against the stored balance of every account; stored balances
+// only exist as of now, so a past trial balance is not reconciled.
+func (smartcontract *SmartContract) trialBalance(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Trial Balance ===============")
+
+	if len(args) > 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	asOf, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reconcile := len(args) == 0
+	if len(args) == 1 {
+		asOf, err = time.Parse(time.RFC3339, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("JOURNAL", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	currencies := map[string]CurrencyTotals{}
+	balances := map[[2]string]money.Amount{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entry := JournalEntry{}
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if entry.Time.After(asOf) {
+			continue
+		}
+
+		for _, line := range entry.Lines {
+			totals := currencies[line.Currency]
+			totals.Debits, err = totals.Debits.Add(line.Debit)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			totals.Credits, err = totals.Credits.Add(line.Credit)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			currencies[line.Currency] = totals
+
+			net, err := line.Credit.Sub(line.Debit)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			key := [2]string{line.Account, line.Currency}
+			balances[key], err = balances[key].Add(net)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
+	trialBalance := TrialBalance{AsOf: asOf.UTC(), Balanced: true, Currencies: map[string]CurrencyTotals{}, Accounts: []AccountBalance{}}
+	for currency, totals := range currencies {
+		totals.Balanced = totals.Debits == totals.Credits
+		trialBalance.Balanced = trialBalance.Balanced && totals.Balanced
+		trialBalance.Currencies[currency] = totals
+	}
+	for key, balance := range balances {
+		trialBalance.Accounts = append(trialBalance.Accounts, AccountBalance{Account: key[0], Currency: key[1], Balance: balance})
+	}
+	sort.Slice(trialBalance.Accounts, func(i, j int) bool {
+		a, b := trialBalance.Accounts[i], trialBalance.Accounts[j]
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.Currency < b.Currency
+	})
+
+	if reconcile {
+		trialBalance.Differences, err = reconcileBalances(stub, balances)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		trialBalance.Reconciled = true
+		trialBalance.Balanced = trialBalance.Balanced && len(trialBalance.Differences) == 0
+	}
+
+	trialBalanceAsBytes, err := json.Marshal(trialBalance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Trial Balance ===============")
+	return shim.Success(trialBalanceAsBytes)
+}
+
+// reconcileBalances compares the stored balances of every account with the
+// journal balances of customer accounts, which are named by account number
+// alone, and returns the differences sorted by account and currency
+func reconcileBalances(stub shim.ChaincodeStubInterface, journal map[[2]string]money.Amount) ([]BalanceDifference, error) {
+	stored := map[[2]string]money.Amount{}
+
+	// Every simple key starting with ACCOUNT, as in queryAllAccounts
+	resultsIterator, err := stub.GetStateByRange("ACCOUNT", "ACCOUNU")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		account := Account{}
+		err = json.Unmarshal(queryResponse.Value, &account)
+		if err != nil {
+			return nil, err
+		}
+		for currency, balance := range account.Balances {
+			stored[[2]string{account.AccountNumber, currency}] = balance
+		}
+	}
+
+	keys := map[[2]string]bool{}
+	for key := range stored {
+		keys[key] = true
+	}
+	for key := range journal {
+		if !strings.Contains(key[0], ":") {
+			keys[key] = true
+		}
+	}
+
+	differences := []BalanceDifference{}
+	for key := range keys {
+		if stored[key] == journal[key] {
+			continue
+		}
+		difference, err := stored[key].Sub(journal[key])
+		if err != nil {
+			return nil, err
+		}
+		differences = append(differences, BalanceDifference{Account: key[0], Currency: key[1], Stored: stored[key], Journal: journal[key], Difference: difference})
+	}
+	sort.Slice(differences, func(i, j int) bool {
+		a, b := differences[i], differences[j]
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.Currency < b.Currency
+	})
+	return differences, nil
+}
+
+// postJournal stores a journal entry for the current transaction after
+// checking that its debits equal its credits in every currency. kind and
+// reference must tell the entry apart from others in the same transaction.
+func postJournal(stub shim.ChaincodeStubInterface, kind string, reference string, lines ...JournalLine) error {
+	net := map[string]money.Amount{}
+	for _, line := range lines {
+		difference, err := line.Debit.Sub(line.Credit)
+		if err != nil {
+			return err
+		}
+		net[line.Currency], err = net[line.Currency].Add(difference)
+		if err != nil {
+			return err
+		}
+	}
+	for currency, difference := range net {
+		if difference != 0 {
+			return fmt.Errorf("Journal entry %s %s does not balance in %s", kind, reference, currency)
+		}
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	entry := JournalEntry{TxID: stub.GetTxID(), Time: now, Kind: kind, Reference: reference, Lines: lines}
+	entryAsBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	entryKey, err := stub.CreateCompositeKey("JOURNAL", []string{entry.TxID, kind, reference})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(entryKey, entryAsBytes)
+}
+
+// debitLine is a journal line debiting amount to account
+func debitLine(account string, currency string, amount money.Amount) JournalLine {
+	return JournalLine{Account: account, Currency: currency, Debit: amount}
+}
+
+// creditLine is a journal line crediting amount to account
+func creditLine(account string, currency string, amount money.Amount) JournalLine {
+	return JournalLine{Account: account, Currency: currency, Credit: amount}
+}
+
+// postOpeningBalance journals the balances an account is created with as
+// cash brought in through its bank
+func postOpeningBalance(stub shim.ChaincodeStubInterface, account Account) error {
+	currencies := []string{}
+	for currency, balance := range account.Balances {
+		if balance != 0 {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+
+	lines := []JournalLine{}
+	for _, currency := range currencies {
+		lines = append(lines,
+			debitLine("CASH:"+account.Bank, currency, account.Balances[currency]),
+			creditLine(account.AccountNumber, currency, account.Balances[currency]))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return postJournal(stub, "open", account.AccountNumber, lines...)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// closeAccount takes the account number, a reason and optionally a sweep
+// account. Without a sweep account every balance must already be zero; with
+// one, each remaining balance is moved there in its own currency. The
+// account is kept on the ledger with status closed so its lifecycle stays
+// auditable, and stays listed in the bank and owner indexes.
+func (smartcontract *SmartContract) closeAccount(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Close Account ===============")
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountNumber := args[0]
+	reason := args[1]
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwnerOrBankAdmin(stub, account); err != nil {
+		return shim.Error(err.Error())
+	}
+	if account.Status != StatusActive {
+		return shim.Error("Account " + accountNumber + " is " + account.Status)
+	}
+	if len(account.Holds) > 0 {
+		return shim.Error("Account " + accountNumber + " is under a hold")
+	}
+
+	// Interest earned so far belongs to the customer and is swept with the
+	// rest of the balance.
+	accrual, err := postInterest(stub, &account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	changes := []BalanceChange{}
+
+	currencies := []string{}
+	for currency, balance := range account.Balances {
+		if balance != 0 {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+
+	if len(currencies) > 0 {
+		if len(args) != 3 {
+			return shim.Error("Account " + accountNumber + " still has a balance; name a sweep account")
+		}
+		if args[2] == accountNumber {
+			return shim.Error("Cannot sweep an account into itself")
+		}
+		sweep, err := getAccount(stub, args[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		sweepAccrual, err := postInterest(stub, &sweep)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changes = append(changes, balanceChanges(accrualChange(sweepAccrual))...)
+
+		for _, currency := range currencies {
+			balance := account.Balances[currency]
+			if balance < 0 {
+				return shim.Error("Account " + accountNumber + " is overdrawn in " + currency)
+			}
+			receipt, err := moveFunds(stub, &account, &sweep, balance, currency, currency, accountNumber+currency)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			changes = append(changes,
+				BalanceChange{AccountNumber: accountNumber, Currency: currency, Reason: "sweep", Amount: -balance, NewBalance: receipt.FromBalance},
+				BalanceChange{AccountNumber: sweep.AccountNumber, Currency: currency, Reason: "sweep", Amount: balance, NewBalance: receipt.ToBalance})
+			fmt.Println(balance, currency, "swept from account", accountNumber, "to account", sweep.AccountNumber)
+		}
+
+		err = putAccount(stub, sweep)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	account.Status = StatusClosed
+	account.StatusReason = reason
+	account.ClosingTxID = stub.GetTxID()
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitAccountEvent(stub, AccountEvent{Type: EventAccountClosed, AccountNumber: accountNumber, Currency: account.Currency, NewBalance: account.Balances[account.Currency],
+		Interest: accrual.Interest, Changes: changes})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Account", accountNumber, "has been closed:", reason)
+	fmt.Println("=============== End Close Account ===============")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) reopenAccount(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Reopen Account ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountNumber := args[0]
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireBankAdmin(stub, account.Bank); err != nil {
+		return shim.Error(err.Error())
+	}
+	if account.Status != StatusClosed {
+		return shim.Error("Account " + accountNumber + " is not closed")
+	}
+
+	// Interest does not accrue for the time the account was closed.
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	account.LastAccrual = now
+	account.Status = StatusActive
+	account.StatusReason = ""
+	account.ClosingTxID = ""
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Account", accountNumber, "has been reopened")
+	fmt.Println("=============== End Reopen Account ===============")
+	return shim.Success(nil)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// Outflow is the total sent from an account during the hour starting at Hour
+type Outflow struct {
+	Hour   time.Time    `json:"Hour"`
+	Amount money.Amount `json:"Amount"`
+}
+
+// setSpendingLimits takes the account number, the per-transaction limit and
+// the rolling 24-hour limit, both in the home currency; "0" removes a limit
+func (smartcontract *SmartContract) setSpendingLimits(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Set Spending Limits ===============")
+
+	if len(args) != 3 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountNumber := args[0]
+	txLimit, err := money.Parse(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dailyLimit, err := money.Parse(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if txLimit < 0 || dailyLimit < 0 {
+		return shim.Error("Spending limits cannot be negative")
+	}
+
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireBankAdmin(stub, account.Bank); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	account.TxLimit = txLimit
+	account.DailyLimit = dailyLimit
+	err = putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Spending limits of account", accountNumber, "set to", txLimit, "per transaction and", dailyLimit, "per 24 hours")
+	fmt.Println("=============== End Set Spending Limits ===============")
+	return shim.Success(nil)
+}
+
+// recordOutflow checks amount against the account's spending limits and adds
+// it to the current hour's outflow. Amounts in other currencies are valued in
+// the home currency at the on-ledger rate. The 24-hour window is measured in
+// whole hours and counts the oldest hour in full, so it errs on the side of
+// rejecting. Accounts without limits are not tracked.
+func recordOutflow(stub shim.ChaincodeStubInterface, account *Account, amount money.Amount, currency string) error {
+	if account.TxLimit == 0 && account.DailyLimit == 0 {
+		return nil
+	}
+
+	homeAmount, err := convertAmount(stub, amount, currency, account.Currency)
+	if err != nil {
+		return err
+	}
+	if account.TxLimit != 0 && homeAmount > account.TxLimit {
+		return fmt.Errorf("Amount exceeds the per-transaction limit of account %s", account.AccountNumber)
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	hour := now.Truncate(time.Hour)
+	windowStart := now.Add(-24 * time.Hour)
+
+	outflows := []Outflow{}
+	total := homeAmount
+	for _, outflow := range account.Outflows {
+		if !outflow.Hour.Add(time.Hour).After(windowStart) {
+			continue
+		}
+		total, err = total.Add(outflow.Amount)
+		if err != nil {
+			return err
+		}
+		outflows = append(outflows, outflow)
+	}
+	if account.DailyLimit != 0 && total > account.DailyLimit {
+		return fmt.Errorf("Amount exceeds the 24-hour limit of account %s", account.AccountNumber)
+	}
+
+	if len(outflows) > 0 && outflows[len(outflows)-1].Hour.Equal(hour) {
+		last := &outflows[len(outflows)-1]
+		last.Amount, err = last.Amount.Add(homeAmount)
+		if err != nil {
+			return err
+		}
+	} else {
+		outflows = append(outflows, Outflow{Hour: hour, Amount: homeAmount})
+	}
+	account.Outflows = outflows
+	return nil
+}
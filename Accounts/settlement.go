@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// Obligation is owed by DebtorBank to CreditorBank after a transfer between
+// their customers. It stays outstanding until a settlement nets it.
+type Obligation struct {
+	DebtorBank   string       `json:"DebtorBank"`
+	CreditorBank string       `json:"CreditorBank"`
+	Currency     string       `json:"Currency"`
+	Amount       money.Amount `json:"Amount"`
+	TxID         string       `json:"TxID"`
+	Time         time.Time    `json:"Time"`
+}
+
+// NetPosition is what PayerBank has to pay PayeeBank in one currency once
+// all obligations between the two in the window are offset
+type NetPosition struct {
+	PayerBank       string       `json:"PayerBank"`
+	PayeeBank       string       `json:"PayeeBank"`
+	Currency        string       `json:"Currency"`
+	Amount          money.Amount `json:"Amount"`
+	ObligationCount int          `json:"ObligationCount"`
+}
+
+// SettlementReport is stored under SETTLEMENT~<txID> by settle
+type SettlementReport struct {
+	SettlementID string        `json:"SettlementID"`
+	WindowEnd    time.Time     `json:"WindowEnd"`
+	Positions    []NetPosition `json:"Positions"`
+	Obligations  []Obligation  `json:"Obligations"`
+}
+
+// settle nets every outstanding obligation created at or before the window
+// end, which defaults to the transaction time. Settled obligations are
+// removed from the outstanding set and kept on the report instead.
+func (smartcontract *SmartContract) settle(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Settle ===============")
+
+	if len(args) > 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	if err := requireAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	windowEnd := now
+	if len(args) == 1 {
+		windowEnd, err = time.Parse(time.RFC3339, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if windowEnd.After(now) {
+			return shim.Error("Settlement window cannot end in the future")
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("OBLIGATION", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	report := SettlementReport{SettlementID: stub.GetTxID(), WindowEnd: windowEnd.UTC(), Positions: []NetPosition{}, Obligations: []Obligation{}}
+	// Each bank pair is keyed in alphabetical order so A->B and B->A land
+	// on the same position; a positive amount means the first bank pays.
+	positions := map[[3]string]*NetPosition{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		obligation := Obligation{}
+		err = json.Unmarshal(queryResponse.Value, &obligation)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if obligation.Time.After(windowEnd) {
+			continue
+		}
+
+		first, second, amount := obligation.DebtorBank, obligation.CreditorBank, obligation.Amount
+		if first > second {
+			first, second = second, first
+			amount, err = amount.Neg()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		pair := [3]string{first, second, obligation.Currency}
+		position, ok := positions[pair]
+		if !ok {
+			position = &NetPosition{PayerBank: first, PayeeBank: second, Currency: obligation.Currency}
+			positions[pair] = position
+		}
+		position.Amount, err = position.Amount.Add(amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		position.ObligationCount++
+
+		report.Obligations = append(report.Obligations, obligation)
+		err = stub.DelState(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	for _, position := range positions {
+		if position.Amount < 0 {
+			position.PayerBank, position.PayeeBank = position.PayeeBank, position.PayerBank
+			position.Amount = -position.Amount
+		}
+		report.Positions = append(report.Positions, *position)
+	}
+	sort.Slice(report.Positions, func(i, j int) bool {
+		a, b := report.Positions[i], report.Positions[j]
+		if a.PayerBank != b.PayerBank {
+			return a.PayerBank < b.PayerBank
+		}
+		if a.PayeeBank != b.PayeeBank {
+			return a.PayeeBank < b.PayeeBank
+		}
+		return a.Currency < b.Currency
+	})
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reportKey, err := stub.CreateCompositeKey("SETTLEMENT", []string{report.SettlementID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(reportKey, reportAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.SetEvent("settlement", reportAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Settled", len(report.Obligations), "obligations into", len(report.Positions), "net positions")
+	fmt.Println("=============== End Settle ===============")
+	return shim.Success(reportAsBytes)
+}
+
+func (smartcontract *SmartContract) querySettlement(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Settlement ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	reportKey, err := stub.CreateCompositeKey("SETTLEMENT", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reportAsBytes, err := stub.GetState(reportKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if reportAsBytes == nil {
+		return shim.Error("Settlement " + args[0] + " does not exist")
+	}
+
+	fmt.Println("=============== End Query Settlement ===============")
+	return shim.Success(reportAsBytes)
+}
+
+// recordObligation stores an outstanding obligation under
+// OBLIGATION~<txID>~<reference>; reference tells apart several transfers
+// made by one transaction
+func recordObligation(stub shim.ChaincodeStubInterface, reference string, debtorBank string, creditorBank string, currency string, amount money.Amount) error {
+	now, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	obligation := Obligation{DebtorBank: debtorBank, CreditorBank: creditorBank, Currency: currency, Amount: amount, TxID: stub.GetTxID(), Time: now}
+	obligationAsBytes, err := json.Marshal(obligation)
+	if err != nil {
+		return err
+	}
+	obligationKey, err := stub.CreateCompositeKey("OBLIGATION", []string{obligation.TxID, reference})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(obligationKey, obligationAsBytes)
+}
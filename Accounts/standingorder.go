@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// Standing order statuses
+const (
+	OrderActive    = "active"
+	OrderCancelled = "cancelled"
+)
+
+// maxCatchUpRuns is how many missed payments of one order executeDueOrders
+// makes per call. Later occurrences are left for the next call so a long
+// backlog cannot time the transaction out for every other order.
+const maxCatchUpRuns = 12
+
+// StandingOrder pays Amount from one account to another every Interval,
+// starting at NextDue. Interval is one of daily, weekly, monthly or yearly.
+type StandingOrder struct {
+	OrderID      string       `json:"OrderID"`
+	From         string       `json:"From"`
+	To           string       `json:"To"`
+	Amount       money.Amount `json:"Amount"`
+	Currency     string       `json:"Currency"`
+	Interval     string       `json:"Interval"`
+	NextDue      time.Time    `json:"NextDue"`
+	Status       string       `json:"Status"`
+	FailureCount int          `json:"FailureCount"`
+}
+
+// OrderRun is the outcome of one due occurrence of a standing order.
+// Failed runs are also stored under ORDERFAILURE~<orderID>~<due time>.
+type OrderRun struct {
+	OrderID string       `json:"OrderID"`
+	Due     time.Time    `json:"Due"`
+	Amount  money.Amount `json:"Amount"`
+	Fee     money.Amount `json:"Fee"`
+	Status  string       `json:"Status"`
+	Reason  string       `json:"Reason"`
+	TxID    string       `json:"TxID"`
+}
+
+// createStandingOrder takes the order ID, source and destination account
+// numbers, amount, currency, interval and RFC3339 time of the first payment
+func (smartcontract *SmartContract) createStandingOrder(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Create Standing Order ===============")
+
+	if len(args) != 7 {
+		return shim.Error("Invalid number of args")
+	}
+
+	order := StandingOrder{OrderID: args[0], From: args[1], To: args[2], Currency: args[4], Interval: args[5], Status: OrderActive}
+
+	amount, err := parsePositiveAmount(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	order.Amount = amount
+	if err := validateCurrency(order.Currency); err != nil {
+		return shim.Error(err.Error())
+	}
+	firstDue, err := time.Parse(time.RFC3339, args[6])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	order.NextDue = firstDue.UTC()
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if order.NextDue.Before(now) {
+		return shim.Error("The first payment of a standing order cannot be in the past")
+	}
+	if _, err := nextDue(order.NextDue, order.Interval); err != nil {
+		return shim.Error(err.Error())
+	}
+	// Adding a month to the 31st lands in the next month but one, so such
+	// schedules would drift.
+	if order.Interval != "daily" && order.Interval != "weekly" && order.NextDue.Day() > 28 {
+		return shim.Error("Monthly and yearly standing orders must start on or before the 28th")
+	}
+	if order.From == order.To {
+		return shim.Error("Cannot pay a standing order to the same account")
+	}
+
+	from, err := getAccount(stub, order.From)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwnerOrBankAdmin(stub, from); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := getAccount(stub, order.To); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existing, err := getStandingOrder(stub, order.OrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Standing order " + order.OrderID + " already exists")
+	}
+
+	err = putStandingOrder(stub, order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Standing order", order.OrderID, "created from account", order.From, "to account", order.To)
+	fmt.Println("=============== End Create Standing Order ===============")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) cancelStandingOrder(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Cancel Standing Order ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	order, err := getStandingOrder(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if order == nil {
+		return shim.Error("Standing order " + args[0] + " does not exist")
+	}
+
+	from, err := getAccount(stub, order.From)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwnerOrBankAdmin(stub, from); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	order.Status = OrderCancelled
+	err = putStandingOrder(stub, *order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Standing order", order.OrderID, "cancelled")
+	fmt.Println("=============== End Cancel Standing Order ===============")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) queryStandingOrder(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Standing Order ===============")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of args")
+	}
+
+	order, err := getStandingOrder(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if order == nil {
+		return shim.Error("Standing order " + args[0] + " does not exist")
+	}
+	orderAsBytes, err := json.Marshal(order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Query Standing Order ===============")
+	return shim.Success(orderAsBytes)
+}
+
+// executeDueOrders can be triggered by anyone. It runs the occurrences of
+// every active order that fell due at or before the transaction time, so a
+// late trigger catches up on missed payments, up to maxCatchUpRuns per order
+// per call. A payment that cannot be made is recorded as failed and the
+// schedule still moves on.
+func (smartcontract *SmartContract) executeDueOrders(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Execute Due Orders ===============")
+
+	if len(args) != 0 {
+		return shim.Error("Invalid number of args")
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// A run refused for its timestamp would otherwise be recorded as failed
+	// and its schedule moved on.
+	if err := requireTxTimeNotAhead(now); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("ORDER", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// GetState does not see this transaction's own writes, so accounts are
+	// loaded once, changed in memory by every order and stored at the end.
+	accounts := map[string]*Account{}
+	runs := []OrderRun{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		order := StandingOrder{}
+		err = json.Unmarshal(queryResponse.Value, &order)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if order.Status != OrderActive || order.NextDue.After(now) {
+			continue
+		}
+
+		for caughtUp := 0; caughtUp < maxCatchUpRuns && !order.NextDue.After(now); caughtUp++ {
+			run := OrderRun{OrderID: order.OrderID, Due: order.NextDue, Amount: order.Amount, Status: "executed", TxID: stub.GetTxID()}
+
+			run.Fee, err = runStandingOrder(stub, accounts, order, run.Due)
+			if err != nil {
+				run.Status = "failed"
+				run.Reason = err.Error()
+				order.FailureCount++
+
+				runAsBytes, err := json.Marshal(run)
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+				failureKey, err := stub.CreateCompositeKey("ORDERFAILURE", []string{order.OrderID, run.Due.Format(time.RFC3339)})
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+				err = stub.PutState(failureKey, runAsBytes)
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+			}
+			runs = append(runs, run)
+
+			order.NextDue, err = nextDue(order.NextDue, order.Interval)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+
+		err = putStandingOrder(stub, order)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	accountNumbers := []string{}
+	for accountNumber := range accounts {
+		accountNumbers = append(accountNumbers, accountNumber)
+	}
+	sort.Strings(accountNumbers)
+	balances := []AccountBalance{}
+	for _, accountNumber := range accountNumbers {
+		account := accounts[accountNumber]
+		err = putAccount(stub, *account)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		currencies := []string{}
+		for currency := range account.Balances {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			balances = append(balances, AccountBalance{Account: accountNumber, Currency: currency, Balance: account.Balances[currency]})
+		}
+	}
+
+	// Fabric keeps one event per transaction, so all runs share it
+	if len(runs) > 0 {
+		err = emitStandingOrdersEvent(stub, StandingOrdersEvent{Runs: runs, Balances: balances})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	runsAsBytes, err := json.Marshal(runs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Ran", len(runs), "standing order payments")
+	fmt.Println("=============== End Execute Due Orders ===============")
+	return shim.Success(runsAsBytes)
+}
+
+// runStandingOrder makes the payment of the order due at due using the
+// cached accounts and charges the payer's bank's transfer fee on it, which
+// it returns. The payment counts towards the payer's spending limits only if
+// it is made.
+func runStandingOrder(stub shim.ChaincodeStubInterface, accounts map[string]*Account, order StandingOrder, due time.Time) (money.Amount, error) {
+	from, err := getCachedAccount(stub, accounts, order.From)
+	if err != nil {
+		return 0, err
+	}
+	to, err := getCachedAccount(stub, accounts, order.To)
+	if err != nil {
+		return 0, err
+	}
+	reference := order.OrderID + "@" + due.Format(time.RFC3339)
+
+	// The revenue account comes from the cache too, so the fee credit is
+	// not overwritten when the cached copy is stored. The payment and its
+	// fee are made together or not at all, so both are checked against a
+	// copy of the payer before anything moves.
+	fee, schedule, err := feeFor(stub, *from, "transfer", order.Amount, order.Currency)
+	if err != nil {
+		return 0, err
+	}
+	loaded := []*Account{to}
+	if fee != 0 {
+		revenueAccount, err := getCachedAccount(stub, accounts, schedule.RevenueAccount)
+		if err != nil {
+			return 0, err
+		}
+		if revenueAccount.Status != StatusActive {
+			return 0, fmt.Errorf("Account %s is %s", revenueAccount.AccountNumber, revenueAccount.Status)
+		}
+		loaded = append(loaded, revenueAccount)
+
+		total, err := order.Amount.Add(fee)
+		if err != nil {
+			return 0, err
+		}
+		payer := *from
+		payer.Balances = map[string]money.Amount{}
+		for currency, balance := range from.Balances {
+			payer.Balances[currency] = balance
+		}
+		err = debit(&payer, order.Currency, total)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	outflows := from.Outflows
+	err = recordOutflow(stub, from, order.Amount, order.Currency)
+	if err != nil {
+		return 0, err
+	}
+	_, err = moveFunds(stub, from, to, order.Amount, order.Currency, order.Currency, reference)
+	if err != nil {
+		from.Outflows = outflows
+		return 0, err
+	}
+	revenue, err := chargeFee(stub, from, "transfer", order.Amount, order.Currency, reference, loaded...)
+	return revenue.Amount, err
+}
+
+// getCachedAccount returns the account from the cache, loading it first if
+// needed
+func getCachedAccount(stub shim.ChaincodeStubInterface, accounts map[string]*Account, accountNumber string) (*Account, error) {
+	if account, ok := accounts[accountNumber]; ok {
+		return account, nil
+	}
+	account, err := getAccount(stub, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	accounts[accountNumber] = &account
+	return &account, nil
+}
+
+// nextDue returns the due time one interval after due
+func nextDue(due time.Time, interval string) (time.Time, error) {
+	switch interval {
+	case "daily":
+		return due.AddDate(0, 0, 1), nil
+	case "weekly":
+		return due.AddDate(0, 0, 7), nil
+	case "monthly":
+		return due.AddDate(0, 1, 0), nil
+	case "yearly":
+		return due.AddDate(1, 0, 0), nil
+	}
+	return due, fmt.Errorf("Interval %s is not one of daily, weekly, monthly or yearly", interval)
+}
+
+// getStandingOrder loads the order stored under ORDER~<orderID>, or nil if
+// there is none
+func getStandingOrder(stub shim.ChaincodeStubInterface, orderID string) (*StandingOrder, error) {
+	orderKey, err := stub.CreateCompositeKey("ORDER", []string{orderID})
+	if err != nil {
+		return nil, err
+	}
+	orderAsBytes, err := stub.GetState(orderKey)
+	if err != nil || orderAsBytes == nil {
+		return nil, err
+	}
+
+	order := StandingOrder{}
+	err = json.Unmarshal(orderAsBytes, &order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// putStandingOrder stores the order under ORDER~<OrderID>
+func putStandingOrder(stub shim.ChaincodeStubInterface, order StandingOrder) error {
+	orderKey, err := stub.CreateCompositeKey("ORDER", []string{order.OrderID})
+	if err != nil {
+		return err
+	}
+	orderAsBytes, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(orderKey, orderAsBytes)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
+)
+
+// StatementLine is one balance change in a statement
+type StatementLine struct {
+	TxID      string       `json:"TxID"`
+	Timestamp time.Time    `json:"Timestamp"`
+	Delta     money.Amount `json:"Delta"`
+	Balance   money.Amount `json:"Balance"`
+}
+
+// Statement is one page of an account statement. OpeningBalance and
+// ClosingBalance bracket the page, so the first page opens with the balance
+// at From and the last page closes with the balance at To. Bookmark is
+// empty on the last page.
+type Statement struct {
+	AccountNumber  string          `json:"AccountNumber"`
+	Currency       string          `json:"Currency"`
+	From           time.Time       `json:"From"`
+	To             time.Time       `json:"To"`
+	OpeningBalance money.Amount    `json:"OpeningBalance"`
+	Transactions   []StatementLine `json:"Transactions"`
+	ClosingBalance money.Amount    `json:"ClosingBalance"`
+	Bookmark       string          `json:"Bookmark"`
+}
+
+// getStatement takes the account number, currency, RFC3339 start and end
+// of the period, page size and the bookmark returned with the previous page
+// (empty for the first page).
+func (smartcontract *SmartContract) getStatement(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Get Statement ===============")
+
+	if len(args) != 6 {
+		return shim.Error("Invalid number of args")
+	}
+
+	accountNumber := args[0]
+	currency := args[1]
+	from, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := time.Parse(time.RFC3339, args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if to.Before(from) {
+		return shim.Error("Statement period ends before it starts")
+	}
+	pageSize, err := strconv.Atoi(args[4])
+	if err != nil || pageSize <= 0 {
+		return shim.Error("Page size must be a positive integer")
+	}
+	bookmark := args[5]
+
+	opening, lines, more, err := getBalanceChanges(stub, accountNumber, currency, from, to, bookmark, pageSize)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	statement := Statement{
+		AccountNumber:  accountNumber,
+		Currency:       currency,
+		From:           from.UTC(),
+		To:             to.UTC(),
+		OpeningBalance: opening,
+		Transactions:   lines,
+		ClosingBalance: opening,
+	}
+	if len(lines) > 0 {
+		statement.ClosingBalance = lines[len(lines)-1].Balance
+		if more {
+			statement.Bookmark = lines[len(lines)-1].TxID
+		}
+	}
+
+	statementAsBytes, err := json.Marshal(statement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Get Statement ===============")
+	return shim.Success(statementAsBytes)
+}
+
+// getBalanceChanges replays the history of the account key, in commit
+// order, and returns one page of the changes to the balance in currency
+// between from and to inclusive: up to pageSize changes after the one whose
+// transaction is bookmark, or from the start of the period if bookmark is
+// empty. It also returns the balance before the page and whether more
+// changes follow. Writes that leave the balance alone are skipped. The
+// replay stops at the first write after to or once the page is full, so a
+// page costs the history up to its end rather than the whole history.
+func getBalanceChanges(stub shim.ChaincodeStubInterface, accountNumber string, currency string, from time.Time, to time.Time, bookmark string, pageSize int) (money.Amount, []StatementLine, bool, error) {
+	historyIterator, err := stub.GetHistoryForKey("ACCOUNT" + accountNumber)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	defer historyIterator.Close()
+
+	opening := money.Amount(0)
+	previous := money.Amount(0)
+	started := bookmark == ""
+	lines := []StatementLine{}
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return 0, nil, false, err
+		}
+
+		line := StatementLine{TxID: modification.TxId}
+		if modification.Timestamp != nil {
+			line.Timestamp = time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC()
+		}
+		if line.Timestamp.After(to) {
+			break
+		}
+		if !modification.IsDelete {
+			account := Account{}
+			err = json.Unmarshal(modification.Value, &account)
+			if err != nil {
+				return 0, nil, false, err
+			}
+			line.Balance = account.Balances[currency]
+		}
+		line.Delta, err = line.Balance.Sub(previous)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		previous = line.Balance
+
+		if line.Timestamp.Before(from) {
+			opening = line.Balance
+			continue
+		}
+		if line.Delta == 0 {
+			continue
+		}
+		if !started {
+			// Changes up to the bookmark were on earlier pages
+			opening = line.Balance
+			started = line.TxID == bookmark
+			continue
+		}
+		if len(lines) == pageSize {
+			return opening, lines, true, nil
+		}
+		lines = append(lines, line)
+	}
+	if !started {
+		return 0, nil, false, fmt.Errorf("Unknown bookmark %s", bookmark)
+	}
+	return opening, lines, false, nil
+}
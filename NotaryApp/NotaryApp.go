@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/yigitpolat/Hyperledger-Fabric-Chaincodes/money"
 	"strconv"
 	"time"
 )
@@ -17,7 +18,7 @@ type User struct {
 	UserID    string
 	UserName  string
 	UserSname string
-	Amount    int
+	Amount    money.Amount
 }
 
 type UserList struct {
@@ -38,7 +39,7 @@ type UserResponse struct {
 	UserID    string
 	UserName  string
 	UserSname string
-	Amount    int
+	Amount    money.Amount
 	AssetList []Asset
 }
 
@@ -107,7 +108,7 @@ func (t *NotaryApp) addUser(stub shim.ChaincodeStubInterface, args []string) pee
 	var UserID string
 	var UserName string
 	var UserSname string
-	var Amount int
+	var Amount money.Amount
 	var err error
 
 	if len(args) != 4 {
@@ -117,7 +118,10 @@ func (t *NotaryApp) addUser(stub shim.ChaincodeStubInterface, args []string) pee
 	UserID = args[0]
 	UserName = args[1]
 	UserSname = args[2]
-	Amount, err = strconv.Atoi(args[3])
+	Amount, err = money.Parse(args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	var user = User{UserID: UserID, UserName: UserName, UserSname: UserSname, Amount: Amount}
 
@@ -589,7 +593,13 @@ func (t *NotaryApp) Deposit(stub shim.ChaincodeStubInterface, args []string) pee
 
 	UserID := args[0]
 	depositAmountAsString := args[1]
-	depositAmount, _ := strconv.Atoi(depositAmountAsString)
+	depositAmount, err := money.Parse(depositAmountAsString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if depositAmount <= 0 {
+		return shim.Error("Deposit amount must be positive")
+	}
 
 	UserByBytes, err := stub.GetState(UserID)
 
@@ -603,9 +613,12 @@ func (t *NotaryApp) Deposit(stub shim.ChaincodeStubInterface, args []string) pee
 		return shim.Error(err.Error())
 	}
 
-	user.Amount += depositAmount
+	user.Amount, err = user.Amount.Add(depositAmount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	UserByBytes, _ = json.Marshal(user)
-	err = stub.PutState("ACCOUNT"+user.UserID, UserByBytes)
+	err = stub.PutState(user.UserID, UserByBytes)
 
 	fmt.Println(depositAmount, "has been added to account", UserID)
 
@@ -627,7 +640,13 @@ func (t *NotaryApp) exchangeAsset(stub shim.ChaincodeStubInterface, args []strin
 	User2ID := args[1]
 	AssetID := args[2]
 	AmountAsString := args[3]
-	Amount, _ := strconv.Atoi(AmountAsString)
+	Amount, err := money.Parse(AmountAsString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if Amount < 0 {
+		return shim.Error("Exchange amount cannot be negative")
+	}
 
 	User1ByBytes, err := stub.GetState(User1ID)
 	User2ByBytes, err := stub.GetState(User2ID)
@@ -648,8 +667,14 @@ func (t *NotaryApp) exchangeAsset(stub shim.ChaincodeStubInterface, args []strin
 	err = json.Unmarshal(AssetAsBytes, &asset)
 
 
-	user1.Amount += Amount
-	user2.Amount -= Amount
+	user1.Amount, err = user1.Amount.Add(Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	user2.Amount, err = user2.Amount.Sub(Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	asset.UserID = user2.UserID
 
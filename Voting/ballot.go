@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// Ballot defined as struct. Every ballot has its own key,
+// BALLOT~election~voterHash, so voters never write to a shared key and
+// concurrent votes do not conflict; candidates' totals are only worked out
+// by the tally. Preferences holds the chosen candidate, or in ranked
+// elections the candidates most preferred first. In secret ballot
+// elections it stays empty until the voter reveals the choice behind
+// Commitment.
+type Ballot struct {
+	ElectionID  string   `json:"ElectionID"`
+	VoterHash   string   `json:"VoterHash"`
+	Preferences []string `json:"Preferences"`
+	Commitment  string   `json:"Commitment"`
+}
+
+// ballotCommitment is the hex SHA-256 of
+// "<electionID>:<voterHash>:<choice>:<salt>", the value a voter submits to
+// commitVote; voters find their hash with queryVoter. The choice is written
+// as for addVote. Binding the commitment to the ballot stops a voter from
+// copying someone else's public commitment and revealing it once the owner
+// has. The salt must be long and random, since an election has few
+// candidates and a short salt could be guessed.
+func ballotCommitment(electionID string, voterHash string, choice string, salt string) string {
+	sum := sha256.Sum256([]byte(electionID + ":" + voterHash + ":" + choice + ":" + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// castBallot validates a voter's choice and stores it on the ballot. It only
+// reads candidates, which do not change once voting opens.
+func castBallot(stub shim.ChaincodeStubInterface, election Election, ballot Ballot, choice string) error {
+	preferences := []string{choice}
+	if election.Ranked {
+		preferences = strings.Split(choice, ",")
+	}
+
+	seen := map[string]bool{}
+	for _, candidateID := range preferences {
+		if seen[candidateID] {
+			return fmt.Errorf("Candidate %s is ranked more than once", candidateID)
+		}
+		seen[candidateID] = true
+
+		candidate, err := getCandidate(stub, election.ElectionID, candidateID)
+		if err != nil {
+			return err
+		}
+		if candidate.Withdrawn {
+			return fmt.Errorf("Candidate %s has withdrawn", candidateID)
+		}
+	}
+
+	ballot.Preferences = preferences
+	return putBallot(stub, ballot)
+}
+
+// commitVote records the invoking voter's sealed ballot in a secret ballot
+// election. Nothing about the choice is stored until it is revealed.
+func (smartcontract *SmartContract) commitVote(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Commit Vote =============== ")
+
+	if len(args) != 2 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	electionID := args[0]
+	commitment := args[1]
+
+	decoded, err := hex.DecodeString(commitment)
+	if err != nil || len(decoded) != sha256.Size {
+		return shim.Error("Commitment must be a hex encoded SHA-256 hash")
+	}
+
+	election, err := requireElectionStatus(stub, electionID, StatusOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !election.SecretBallot {
+		return shim.Error("Election does not use secret ballots; use addVote")
+	}
+	if err := requireEligibleVoter(stub, election); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hash, err := getCallerVoterHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = getVoter(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballot, err := getBallot(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ballot != nil {
+		return shim.Error("Voter already voted a candidate")
+	}
+	delegation, err := getDelegation(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation != nil {
+		return shim.Error("Voter delegated the vote; revoke the delegation first")
+	}
+
+	err = putBallot(stub, Ballot{ElectionID: electionID, VoterHash: hash, Commitment: hex.EncodeToString(decoded)})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Commit Vote =============== ")
+	return shim.Success(nil)
+}
+
+// revealVote opens the invoking voter's committed ballot once voting has
+// closed, so the tally counts it, if the choice and salt match the
+// commitment. Ballots that are
+// never revealed before the tally are not counted.
+func (smartcontract *SmartContract) revealVote(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Reveal Vote =============== ")
+
+	if len(args) != 3 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	electionID := args[0]
+	choice := args[1]
+	salt := args[2]
+
+	election, err := requireElectionStatus(stub, electionID, StatusClosed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !election.SecretBallot {
+		return shim.Error("Election does not use secret ballots")
+	}
+
+	hash, err := getCallerVoterHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballot, err := getBallot(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ballot == nil {
+		return shim.Error("Voter did not commit a vote")
+	}
+	if len(ballot.Preferences) > 0 {
+		return shim.Error("Vote already revealed")
+	}
+	if ballotCommitment(electionID, hash, choice, salt) != ballot.Commitment {
+		return shim.Error("Choice and salt do not match the commitment")
+	}
+
+	err = castBallot(stub, election, *ballot, choice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Reveal Vote =============== ")
+	return shim.Success(nil)
+}
+
+// getBallot returns the voter's ballot, or nil if they have not voted
+func getBallot(stub shim.ChaincodeStubInterface, electionID string, hash string) (*Ballot, error) {
+	ballotKey, err := stub.CreateCompositeKey("BALLOT", []string{electionID, hash})
+	if err != nil {
+		return nil, err
+	}
+	ballotAsBytes, err := stub.GetState(ballotKey)
+	if err != nil || ballotAsBytes == nil {
+		return nil, err
+	}
+
+	ballot := Ballot{}
+	err = json.Unmarshal(ballotAsBytes, &ballot)
+	if err != nil {
+		return nil, err
+	}
+	return &ballot, nil
+}
+
+func putBallot(stub shim.ChaincodeStubInterface, ballot Ballot) error {
+	ballotKey, err := stub.CreateCompositeKey("BALLOT", []string{ballot.ElectionID, ballot.VoterHash})
+	if err != nil {
+		return err
+	}
+	ballotAsBytes, err := json.Marshal(ballot)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(ballotKey, ballotAsBytes)
+}
+
+// getBallots returns the preferences of every counted ballot of the
+// election, leaving out unrevealed secret ballots. A ballot carrying
+// delegated votes appears once for each vote.
+func getBallots(stub shim.ChaincodeStubInterface, electionID string) ([][]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("BALLOT", []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ballots := map[string]Ballot{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		ballot := Ballot{}
+		err = json.Unmarshal(queryResponse.Value, &ballot)
+		if err != nil {
+			return nil, err
+		}
+		ballots[ballot.VoterHash] = ballot
+	}
+
+	delegations, err := getDelegations(stub, electionID)
+	if err != nil {
+		return nil, err
+	}
+	weights := map[string]int{}
+	for hash := range ballots {
+		weights[hash] = 1
+	}
+	for hash := range delegations {
+		if _, voted := ballots[hash]; voted {
+			continue
+		}
+		// follow the chain to the first voter who cast a ballot
+		seen := map[string]bool{hash: true}
+		next := delegations[hash]
+		for next != "" && !seen[next] {
+			if _, voted := ballots[next]; voted {
+				weights[next]++
+				break
+			}
+			seen[next] = true
+			next = delegations[next]
+		}
+	}
+
+	hashes := []string{}
+	for hash := range ballots {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	counted := [][]string{}
+	for _, hash := range hashes {
+		if len(ballots[hash].Preferences) == 0 {
+			continue
+		}
+		for i := 0; i < weights[hash]; i++ {
+			counted = append(counted, ballots[hash].Preferences)
+		}
+	}
+	fmt.Println("Counting", len(counted), "votes on", len(ballots), "ballots for election", electionID)
+	return counted, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// Delegation defined as struct. It is stored under
+// DELEGATION~election~voterHash and hands the voter's vote to the delegate,
+// another voter of the same election.
+//
+// Delegation is transitive: if the delegate delegates too, the vote follows
+// the chain to the first voter on it who casts a ballot, and is lost if
+// nobody on the chain does. A voter with a delegation cannot cast a ballot,
+// and one who has cast a ballot cannot delegate. Chains that loop back are
+// refused. Each voter's vote therefore counts exactly once, either on their
+// own ballot or on one delegate's, and the tally weights every ballot by
+// the number of votes it carries.
+type Delegation struct {
+	ElectionID   string `json:"ElectionID"`
+	VoterHash    string `json:"VoterHash"`
+	DelegateHash string `json:"DelegateHash"`
+}
+
+// delegateVote hands the invoking voter's vote to the voter registered with
+// the national ID passed as "delegateNationalID" in the transient map. It is
+// possible until voting closes.
+func (smartcontract *SmartContract) delegateVote(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Delegate Vote =============== ")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	electionID := args[0]
+	election, err := requireDelegationPhase(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireEligibleVoter(stub, election); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hash, err := getCallerVoterHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delegateHash, _, err := getNationalIDHash(stub, electionID, "delegateNationalID")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = getVoter(stub, electionID, delegateHash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delegation, err := getDelegation(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation != nil {
+		return shim.Error("Voter already delegated; revoke the delegation first")
+	}
+	ballot, err := getBallot(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ballot != nil {
+		return shim.Error("Voter already voted a candidate")
+	}
+
+	// follow the delegate's own chain to make sure it does not lead back
+	next := delegateHash
+	for next != "" {
+		if next == hash {
+			return shim.Error("Delegation would form a loop")
+		}
+		nextDelegation, err := getDelegation(stub, electionID, next)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		next = ""
+		if nextDelegation != nil {
+			next = nextDelegation.DelegateHash
+		}
+	}
+
+	err = putDelegation(stub, Delegation{ElectionID: electionID, VoterHash: hash, DelegateHash: delegateHash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Voter", hash, "delegated to", delegateHash)
+	fmt.Println("=============== End Delegate Vote =============== ")
+	return shim.Success(nil)
+}
+
+// revokeDelegation takes back the invoking voter's delegation, so they can
+// vote themselves or delegate to someone else. It is refused once the voter
+// the delegated vote ends up with has cast a ballot.
+func (smartcontract *SmartContract) revokeDelegation(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Revoke Delegation =============== ")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	electionID := args[0]
+	if _, err := requireDelegationPhase(stub, electionID); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hash, err := getCallerVoterHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delegation, err := getDelegation(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation == nil {
+		return shim.Error("Voter has not delegated")
+	}
+
+	next := delegation.DelegateHash
+	for next != "" {
+		ballot, err := getBallot(stub, electionID, next)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if ballot != nil {
+			return shim.Error("The delegated vote has already been cast")
+		}
+		nextDelegation, err := getDelegation(stub, electionID, next)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		next = ""
+		if nextDelegation != nil {
+			next = nextDelegation.DelegateHash
+		}
+	}
+
+	delegationKey, err := stub.CreateCompositeKey("DELEGATION", []string{electionID, hash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(delegationKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Revoke Delegation =============== ")
+	return shim.Success(nil)
+}
+
+// requireDelegationPhase checks that delegations of the election can still
+// change, which is during registration and while voting is open
+func requireDelegationPhase(stub shim.ChaincodeStubInterface, electionID string) (Election, error) {
+	election, err := getElection(stub, electionID)
+	if err != nil {
+		return election, err
+	}
+	if election.Status == StatusRegistration {
+		return election, nil
+	}
+	return requireElectionStatus(stub, electionID, StatusOpen)
+}
+
+// getDelegation returns the voter's delegation, or nil if they have not
+// delegated
+func getDelegation(stub shim.ChaincodeStubInterface, electionID string, hash string) (*Delegation, error) {
+	delegationKey, err := stub.CreateCompositeKey("DELEGATION", []string{electionID, hash})
+	if err != nil {
+		return nil, err
+	}
+	delegationAsBytes, err := stub.GetState(delegationKey)
+	if err != nil || delegationAsBytes == nil {
+		return nil, err
+	}
+
+	delegation := Delegation{}
+	err = json.Unmarshal(delegationAsBytes, &delegation)
+	if err != nil {
+		return nil, err
+	}
+	return &delegation, nil
+}
+
+func putDelegation(stub shim.ChaincodeStubInterface, delegation Delegation) error {
+	delegationKey, err := stub.CreateCompositeKey("DELEGATION", []string{delegation.ElectionID, delegation.VoterHash})
+	if err != nil {
+		return err
+	}
+	delegationAsBytes, err := json.Marshal(delegation)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(delegationKey, delegationAsBytes)
+}
+
+// getDelegations returns every delegation of the election as a map from
+// voter hash to delegate hash
+func getDelegations(stub shim.ChaincodeStubInterface, electionID string) (map[string]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("DELEGATION", []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	delegations := map[string]string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		delegation := Delegation{}
+		err = json.Unmarshal(queryResponse.Value, &delegation)
+		if err != nil {
+			return nil, err
+		}
+		delegations[delegation.VoterHash] = delegation.DelegateHash
+	}
+	return delegations, nil
+}
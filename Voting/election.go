@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// Election statuses, in the order an election goes through them
+const (
+	StatusDraft        = "draft"
+	StatusRegistration = "registration"
+	StatusOpen         = "open"
+	StatusClosed       = "closed"
+	StatusTallied      = "tallied"
+)
+
+// Election defined as struct. Votes are accepted while Status is open and
+// the transaction time is between StartTime and EndTime. Its candidates
+// and voters are stored under CANDIDATE~election~id and
+// VOTER~election~voterHash. Secret ballot elections take commitments
+// with commitVote while open and count them as revealVote reveals them
+// after close. Ranked elections are decided by instant runoff; the rounds
+// are kept in Rounds.
+type Election struct {
+	ElectionID   string        `json:"ElectionID"`
+	Title        string        `json:"Title"`
+	Status       string        `json:"Status"`
+	SecretBallot bool          `json:"SecretBallot"`
+	Ranked       bool          `json:"Ranked"`
+	Eligibility  Eligibility   `json:"Eligibility"`
+	StartTime    time.Time     `json:"StartTime"`
+	EndTime      time.Time     `json:"EndTime"`
+	Results      []Candidate   `json:"Results"`
+	Winner       string        `json:"Winner"`
+	Rounds       []RunoffRound `json:"Rounds"`
+}
+
+// createElection creates a draft election without candidates. Arguments
+// after the title are options: "secret" for secret ballots and "ranked"
+// for ranked ballots. The salt for voter hashes is passed as "salt" in the
+// transient map and should be random.
+func (smartcontract *SmartContract) createElection(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Create Election =============== ")
+
+	if len(args) < 2 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	if err := requireElectionAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election := Election{ElectionID: args[0], Title: args[1], Status: StatusDraft}
+	if election.ElectionID == "" {
+		return shim.Error("Election ID must not be empty")
+	}
+	for _, option := range args[2:] {
+		if option == "secret" {
+			election.SecretBallot = true
+		} else if option == "ranked" {
+			election.Ranked = true
+		} else {
+			return shim.Error("Unknown election option " + option)
+		}
+	}
+
+	electionAsBytes, err := getElectionState(stub, election.ElectionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionAsBytes != nil {
+		return shim.Error("Election already exists")
+	}
+
+	err = putElectionSalt(stub, election.ElectionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Added election", election.ElectionID, election.Title)
+	fmt.Println("=============== End Create Election =============== ")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) queryElection(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Election =============== ")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	electionAsBytes, err := getElectionState(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if electionAsBytes == nil {
+		return shim.Error("Election does not exist")
+	}
+
+	fmt.Println("=============== End Query Election =============== ")
+	return shim.Success(electionAsBytes)
+}
+
+func (smartcontract *SmartContract) queryAllElections(stub shim.ChaincodeStubInterface) peer.Response {
+	fmt.Println("=============== Start Query All Elections =============== ")
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("ELECTION", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResponse.Value)
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	fmt.Println("=============== End Query All Elections =============== ")
+	return shim.Success(buffer.Bytes())
+}
+
+// scheduleElection sets the RFC3339 start and end of voting. It can be
+// changed until voting opens.
+func (smartcontract *SmartContract) scheduleElection(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Schedule Election =============== ")
+
+	if len(args) != 3 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	if err := requireElectionAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	startTime, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	endTime, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !endTime.After(startTime) {
+		return shim.Error("Election must end after it starts")
+	}
+
+	election, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.Status != StatusDraft && election.Status != StatusRegistration {
+		return shim.Error("Election can no longer be rescheduled")
+	}
+
+	election.StartTime = startTime.UTC()
+	election.EndTime = endTime.UTC()
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Election", election.ElectionID, "scheduled from", election.StartTime, "to", election.EndTime)
+	fmt.Println("=============== End Schedule Election =============== ")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) openRegistration(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Open Registration =============== ")
+
+	election, err := transitionElection(stub, args, StatusDraft, StatusRegistration)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.StartTime.IsZero() {
+		return shim.Error("Election must be scheduled before registration opens")
+	}
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Open Registration =============== ")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) openVoting(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Open Voting =============== ")
+
+	election, err := transitionElection(stub, args, StatusRegistration, StatusOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Before(election.StartTime) || !now.Before(election.EndTime) {
+		return shim.Error("Voting can only open between the start and end of the election")
+	}
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Open Voting =============== ")
+	return shim.Success(nil)
+}
+
+func (smartcontract *SmartContract) closeVoting(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Close Voting =============== ")
+
+	election, err := transitionElection(stub, args, StatusOpen, StatusClosed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Before(election.EndTime) {
+		return shim.Error("Voting cannot close before the end of the election")
+	}
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Close Voting =============== ")
+	return shim.Success(nil)
+}
+
+// tallyElection counts the ballots into the standing candidates' TotalVote
+// and the election's Results, ordered by votes and then candidate ID, and
+// names the Winner. A tie for the most votes leaves Winner empty. Ranked
+// elections are won by instant runoff instead, and also get their rounds.
+// The results are final.
+func (smartcontract *SmartContract) tallyElection(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Tally Election =============== ")
+
+	election, err := transitionElection(stub, args, StatusClosed, StatusTallied)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	candidates, err := getCandidates(stub, election.ElectionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballots, err := getBallots(stub, election.ElectionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	firstPreferences := map[string]int{}
+	for _, ballot := range ballots {
+		firstPreferences[ballot[0]]++
+	}
+
+	election.Results = []Candidate{}
+	for _, candidate := range candidates {
+		if candidate.Withdrawn {
+			continue
+		}
+		candidate.TotalVote = firstPreferences[candidate.CandidateID]
+		err = putCandidate(stub, candidate)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		election.Results = append(election.Results, candidate)
+	}
+	sort.SliceStable(election.Results, func(i, j int) bool {
+		if election.Results[i].TotalVote != election.Results[j].TotalVote {
+			return election.Results[i].TotalVote > election.Results[j].TotalVote
+		}
+		return election.Results[i].CandidateID < election.Results[j].CandidateID
+	})
+
+	if election.Ranked {
+		candidateIDs := []string{}
+		for _, candidate := range election.Results {
+			candidateIDs = append(candidateIDs, candidate.CandidateID)
+		}
+		election.Winner, election.Rounds = runInstantRunoff(candidateIDs, ballots)
+	} else if len(election.Results) > 0 && election.Results[0].TotalVote > 0 {
+		if len(election.Results) == 1 || election.Results[1].TotalVote < election.Results[0].TotalVote {
+			election.Winner = election.Results[0].CandidateID
+		}
+	}
+
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	electionAsBytes, err := json.Marshal(election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Tally Election =============== ")
+	return shim.Success(electionAsBytes)
+}
+
+// transitionElection checks the caller is an election admin and the
+// election named by args[0] is in status from, and returns it moved to
+// status to. The caller stores it after any further checks.
+func transitionElection(stub shim.ChaincodeStubInterface, args []string, from string, to string) (Election, error) {
+	if len(args) != 1 {
+		return Election{}, fmt.Errorf("Invalid number of arguments.")
+	}
+	if err := requireElectionAdmin(stub); err != nil {
+		return Election{}, err
+	}
+
+	election, err := getElection(stub, args[0])
+	if err != nil {
+		return election, err
+	}
+	if election.Status != from {
+		return election, fmt.Errorf("Election is %s, not %s", election.Status, from)
+	}
+	election.Status = to
+	return election, nil
+}
+
+// requireElectionStatus checks that the election is in the given status
+// and, for open elections, that the transaction falls within voting hours
+func requireElectionStatus(stub shim.ChaincodeStubInterface, electionID string, status string) (Election, error) {
+	election, err := getElection(stub, electionID)
+	if err != nil {
+		return election, err
+	}
+	if election.Status != status {
+		return election, fmt.Errorf("Election is %s, not %s", election.Status, status)
+	}
+	if status != StatusOpen {
+		return election, nil
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return election, err
+	}
+	if now.Before(election.StartTime) || now.After(election.EndTime) {
+		return election, fmt.Errorf("Voting is only possible between %s and %s", election.StartTime, election.EndTime)
+	}
+	return election, nil
+}
+
+// requireElectionNotOpened checks that the election has not opened for
+// voting yet, which is when its candidates can still change
+func requireElectionNotOpened(stub shim.ChaincodeStubInterface, electionID string) error {
+	election, err := getElection(stub, electionID)
+	if err != nil {
+		return err
+	}
+	if election.Status != StatusDraft && election.Status != StatusRegistration {
+		return fmt.Errorf("Election is %s; candidates can only change before voting opens", election.Status)
+	}
+	return nil
+}
+
+// requireElectionAdmin checks that the caller's certificate carries the
+// role=election-admin attribute
+func requireElectionAdmin(stub shim.ChaincodeStubInterface) error {
+	err := cid.AssertAttributeValue(stub, "role", "election-admin")
+	if err != nil {
+		return fmt.Errorf("Caller is not an election admin: %s", err)
+	}
+	return nil
+}
+
+// getElectionState returns the stored election, or nil if there is none
+func getElectionState(stub shim.ChaincodeStubInterface, electionID string) ([]byte, error) {
+	electionKey, err := stub.CreateCompositeKey("ELECTION", []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	return stub.GetState(electionKey)
+}
+
+func getElection(stub shim.ChaincodeStubInterface, electionID string) (Election, error) {
+	election := Election{}
+
+	electionAsBytes, err := getElectionState(stub, electionID)
+	if err != nil {
+		return election, err
+	}
+	if electionAsBytes == nil {
+		return election, fmt.Errorf("Election %s does not exist", electionID)
+	}
+
+	err = json.Unmarshal(electionAsBytes, &election)
+	return election, err
+}
+
+func putElection(stub shim.ChaincodeStubInterface, election Election) error {
+	electionKey, err := stub.CreateCompositeKey("ELECTION", []string{election.ElectionID})
+	if err != nil {
+		return err
+	}
+	electionAsBytes, err := json.Marshal(election)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(electionKey, electionAsBytes)
+}
+
+// getTxTime returns the transaction timestamp, which every endorser sees
+// identically, as a UTC time
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
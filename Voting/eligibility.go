@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// Eligibility defined as struct. Every voter needs the voter=true
+// certificate attribute; an election can further require the region and
+// class attributes to be one of the listed values. An empty list allows
+// any value.
+type Eligibility struct {
+	Regions []string `json:"Regions"`
+	Classes []string `json:"Classes"`
+}
+
+// setEligibility sets the regions and classes, each a comma separated list
+// that may be empty, whose voters can take part. It can be changed until
+// registration opens.
+func (smartcontract *SmartContract) setEligibility(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Set Eligibility =============== ")
+
+	if len(args) != 3 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	if err := requireElectionAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := getElection(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.Status != StatusDraft {
+		return shim.Error("Eligibility can only change before registration opens")
+	}
+
+	election.Eligibility = Eligibility{Regions: splitList(args[1]), Classes: splitList(args[2])}
+	err = putElection(stub, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("Election", election.ElectionID, "eligibility", election.Eligibility)
+	fmt.Println("=============== End Set Eligibility =============== ")
+	return shim.Success(nil)
+}
+
+// requireEligibleVoter checks the invoking client's certificate attributes
+// against the election's eligibility rules
+func requireEligibleVoter(stub shim.ChaincodeStubInterface, election Election) error {
+	err := cid.AssertAttributeValue(stub, "voter", "true")
+	if err != nil {
+		return fmt.Errorf("Caller is not a voter: %s", err)
+	}
+
+	err = requireAttributeIn(stub, "region", election.Eligibility.Regions)
+	if err != nil {
+		return err
+	}
+	return requireAttributeIn(stub, "class", election.Eligibility.Classes)
+}
+
+func requireAttributeIn(stub shim.ChaincodeStubInterface, name string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	value, found, err := cid.GetAttributeValue(stub, name)
+	if err != nil {
+		return err
+	}
+	if found {
+		for _, allowedValue := range allowed {
+			if value == allowedValue {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("Caller's %s is not eligible for this election", name)
+}
+
+// splitList splits a comma separated list, treating an empty string as an
+// empty list
+func splitList(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+// voterCollection is the private data collection, readable only by the
+// election authority's org, ElectionAuthorityMSP, that holds voters'
+// personal data, the national IDs behind voter IDs and the election salts.
+// See collections_config.json.
+const voterCollection = "collectionVoters"
+
+// minSaltLength is the shortest election salt accepted, in bytes
+const minSaltLength = 16
+
+// VoterDetails defined as struct. It is kept in voterCollection under
+// VOTERDETAILS~election~voterHash.
+type VoterDetails struct {
+	ElectionID string `json:"ElectionID"`
+	VoterHash  string `json:"VoterHash"`
+	NationalID string `json:"NationalID"`
+	Name       string `json:"Name"`
+}
+
+// voterHash is the hex HMAC-SHA256 of the national ID keyed with the
+// election's salt. Only this hash identifies a voter in public state; the
+// salt stops anyone without the private data from hashing candidate
+// national IDs to find a voter.
+func voterHash(salt []byte, nationalID string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(nationalID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getTransientValue returns a value passed in the proposal's transient map,
+// which is not written to the ledger, unlike the arguments
+func getTransientValue(stub shim.ChaincodeStubInterface, name string) (string, error) {
+	transientMap, err := stub.GetTransient()
+	if err != nil {
+		return "", err
+	}
+	value, ok := transientMap[name]
+	if !ok || len(value) == 0 {
+		return "", fmt.Errorf("%s must be passed in the transient map", name)
+	}
+	return string(value), nil
+}
+
+// putElectionSalt stores the salt passed as "salt" in the transient map for
+// a new election
+func putElectionSalt(stub shim.ChaincodeStubInterface, electionID string) error {
+	salt, err := getTransientValue(stub, "salt")
+	if err != nil {
+		return err
+	}
+	if len(salt) < minSaltLength {
+		return fmt.Errorf("Salt must be at least %d bytes", minSaltLength)
+	}
+
+	saltKey, err := stub.CreateCompositeKey("SALT", []string{electionID})
+	if err != nil {
+		return err
+	}
+	return stub.PutPrivateData(voterCollection, saltKey, []byte(salt))
+}
+
+func getElectionSalt(stub shim.ChaincodeStubInterface, electionID string) ([]byte, error) {
+	saltKey, err := stub.CreateCompositeKey("SALT", []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	salt, err := stub.GetPrivateData(voterCollection, saltKey)
+	if err != nil {
+		return nil, err
+	}
+	if salt == nil {
+		return nil, fmt.Errorf("Salt of election %s is not available on this peer", electionID)
+	}
+	return salt, nil
+}
+
+// getNationalIDHash hashes the national ID passed under name in the
+// transient map with the election's salt. Only peers of the collection's
+// orgs can read the salt, so they endorse every call that identifies a
+// voter.
+func getNationalIDHash(stub shim.ChaincodeStubInterface, electionID string, name string) (string, string, error) {
+	nationalID, err := getTransientValue(stub, name)
+	if err != nil {
+		return "", "", err
+	}
+	salt, err := getElectionSalt(stub, electionID)
+	if err != nil {
+		return "", "", err
+	}
+	return voterHash(salt, nationalID), nationalID, nil
+}
+
+// mapVoterID records, for an election admin, which national ID the
+// authority's CA issued a voterID certificate attribute for. Both are
+// passed as "voterID" and "nationalID" in the transient map and kept in
+// voterCollection under VOTERID~voterID. Certificates are public with
+// every transaction, so the attribute must be opaque, e.g. a random ID;
+// the national ID itself never leaves the collection. A voter ID cannot
+// be mapped twice.
+func (smartcontract *SmartContract) mapVoterID(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Map Voter ID =============== ")
+
+	if len(args) != 0 {
+		return shim.Error("Invalid number of arguments.")
+	}
+	if err := requireElectionAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voterID, err := getTransientValue(stub, "voterID")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	nationalID, err := getTransientValue(stub, "nationalID")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voterIDKey, err := stub.CreateCompositeKey("VOTERID", []string{voterID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := stub.GetPrivateData(voterCollection, voterIDKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Voter ID is already mapped")
+	}
+	err = stub.PutPrivateData(voterCollection, voterIDKey, []byte(nationalID))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("=============== End Map Voter ID =============== ")
+	return shim.Success(nil)
+}
+
+// getCallerNationalIDHash looks up the national ID mapped to the voterID
+// attribute of the invoking client's certificate and hashes it with the
+// election's salt. Callers cannot choose the attribute, so nobody can
+// register under someone else's ID, and the certificate only carries the
+// opaque voter ID.
+func getCallerNationalIDHash(stub shim.ChaincodeStubInterface, electionID string) (string, string, error) {
+	voterID, found, err := cid.GetAttributeValue(stub, "voterID")
+	if err != nil {
+		return "", "", err
+	}
+	if !found || voterID == "" {
+		return "", "", fmt.Errorf("Caller's certificate has no voterID attribute")
+	}
+	voterIDKey, err := stub.CreateCompositeKey("VOTERID", []string{voterID})
+	if err != nil {
+		return "", "", err
+	}
+	nationalIDAsBytes, err := stub.GetPrivateData(voterCollection, voterIDKey)
+	if err != nil {
+		return "", "", err
+	}
+	if nationalIDAsBytes == nil {
+		return "", "", fmt.Errorf("Voter ID %s is not mapped to a national ID", voterID)
+	}
+	nationalID := string(nationalIDAsBytes)
+	salt, err := getElectionSalt(stub, electionID)
+	if err != nil {
+		return "", "", err
+	}
+	return voterHash(salt, nationalID), nationalID, nil
+}
+
+// getCallerIdentityHash hashes the invoking client's MSP ID and certificate
+// ID with the election's salt
+func getCallerIdentityHash(stub shim.ChaincodeStubInterface, electionID string) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	clientID, err := cid.GetID(stub)
+	if err != nil {
+		return "", err
+	}
+	salt, err := getElectionSalt(stub, electionID)
+	if err != nil {
+		return "", err
+	}
+	return voterHash(salt, mspID+"/"+clientID), nil
+}
+
+// getCallerVoterHash returns the voter hash the invoking client registered
+// with, so voters can only ever act for themselves
+func getCallerVoterHash(stub shim.ChaincodeStubInterface, electionID string) (string, error) {
+	identityHash, err := getCallerIdentityHash(stub, electionID)
+	if err != nil {
+		return "", err
+	}
+	identityKey, err := stub.CreateCompositeKey("VOTERIDENTITY", []string{electionID, identityHash})
+	if err != nil {
+		return "", err
+	}
+	hash, err := stub.GetState(identityKey)
+	if err != nil {
+		return "", err
+	}
+	if hash == nil {
+		return "", fmt.Errorf("Caller is not registered for election %s", electionID)
+	}
+	return string(hash), nil
+}
+
+// queryVoterDetails returns the caller's personal data as registered. It
+// can only be endorsed by peers of the election authority's org.
+func (smartcontract *SmartContract) queryVoterDetails(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query Voter Details =============== ")
+
+	if len(args) != 1 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	hash, err := getCallerVoterHash(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	detailsKey, err := stub.CreateCompositeKey("VOTERDETAILS", []string{args[0], hash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	detailsAsBytes, err := stub.GetPrivateData(voterCollection, detailsKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if detailsAsBytes == nil {
+		return shim.Error("Voter is not registered for this election")
+	}
+
+	fmt.Println("=============== End Query Voter Details =============== ")
+	return shim.Success(detailsAsBytes)
+}
+
+func putVoterDetails(stub shim.ChaincodeStubInterface, details VoterDetails) error {
+	detailsKey, err := stub.CreateCompositeKey("VOTERDETAILS", []string{details.ElectionID, details.VoterHash})
+	if err != nil {
+		return err
+	}
+	detailsAsBytes, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return stub.PutPrivateData(voterCollection, detailsKey, detailsAsBytes)
+}
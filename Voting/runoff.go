@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+)
+
+// RunoffRound defined as struct. Counts holds the votes of every candidate
+// still in the count; Exhausted is the number of ballots with no such
+// candidate left on them.
+type RunoffRound struct {
+	Round      int            `json:"Round"`
+	Counts     map[string]int `json:"Counts"`
+	Exhausted  int            `json:"Exhausted"`
+	Eliminated string         `json:"Eliminated"`
+}
+
+// runInstantRunoff counts the ballots in rounds. Each ballot counts for its
+// highest ranked candidate still in the count. A candidate with more than
+// half of the ballots that are not exhausted wins; otherwise the candidate
+// with the fewest votes is eliminated and the next round is counted.
+//
+// Ties for fewest votes are broken by looking back through the earlier
+// rounds, most recent first, and eliminating whichever tied candidate had
+// fewer votes in the first round where they differ. If they were tied in
+// every round, the candidate with the greatest ID is eliminated.
+//
+// The winner is empty if no ballot counts for a standing candidate.
+func runInstantRunoff(candidateIDs []string, ballots [][]string) (string, []RunoffRound) {
+	continuing := map[string]bool{}
+	for _, candidateID := range candidateIDs {
+		continuing[candidateID] = true
+	}
+
+	rounds := []RunoffRound{}
+	for len(continuing) > 0 {
+		round := RunoffRound{Round: len(rounds) + 1, Counts: map[string]int{}}
+		for candidateID := range continuing {
+			round.Counts[candidateID] = 0
+		}
+
+		active := 0
+		for _, ballot := range ballots {
+			counted := false
+			for _, candidateID := range ballot {
+				if continuing[candidateID] {
+					round.Counts[candidateID]++
+					counted = true
+					break
+				}
+			}
+			if counted {
+				active++
+			} else {
+				round.Exhausted++
+			}
+		}
+
+		remaining := sortedCandidateIDs(continuing)
+		if active == 0 {
+			rounds = append(rounds, round)
+			return "", rounds
+		}
+		for _, candidateID := range remaining {
+			if round.Counts[candidateID]*2 > active || len(remaining) == 1 {
+				rounds = append(rounds, round)
+				return candidateID, rounds
+			}
+		}
+
+		rounds = append(rounds, round)
+		last := &rounds[len(rounds)-1]
+		last.Eliminated = pickElimination(remaining, rounds)
+		delete(continuing, last.Eliminated)
+	}
+	return "", rounds
+}
+
+// pickElimination returns the candidate to eliminate after the last of
+// rounds, applying the tie-break described on runInstantRunoff
+func pickElimination(remaining []string, rounds []RunoffRound) string {
+	tied := remaining
+	for r := len(rounds) - 1; r >= 0 && len(tied) > 1; r-- {
+		fewest := -1
+		for _, candidateID := range tied {
+			if fewest == -1 || rounds[r].Counts[candidateID] < fewest {
+				fewest = rounds[r].Counts[candidateID]
+			}
+		}
+		lowest := []string{}
+		for _, candidateID := range tied {
+			if rounds[r].Counts[candidateID] == fewest {
+				lowest = append(lowest, candidateID)
+			}
+		}
+		tied = lowest
+	}
+	return tied[len(tied)-1]
+}
+
+func sortedCandidateIDs(candidates map[string]bool) []string {
+	candidateIDs := []string{}
+	for candidateID := range candidates {
+		candidateIDs = append(candidateIDs, candidateID)
+	}
+	sort.Strings(candidateIDs)
+	return candidateIDs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunInstantRunoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		ballots    [][]string
+		winner     string
+		eliminated []string
+		exhausted  []int
+	}{
+		{
+			name:       "outright majority",
+			candidates: []string{"A", "B", "C"},
+			ballots:    [][]string{{"A"}, {"A"}, {"B"}},
+			winner:     "A",
+			eliminated: []string{""},
+			exhausted:  []int{0},
+		},
+		{
+			name:       "multi-round elimination",
+			candidates: []string{"A", "B", "C"},
+			ballots:    [][]string{{"A"}, {"A"}, {"B"}, {"B"}, {"C", "B"}},
+			winner:     "B",
+			eliminated: []string{"C", ""},
+			exhausted:  []int{0, 0},
+		},
+		{
+			// B and C tie on 3 in round 2; B had fewer in round 1, so B
+			// goes although C has the greater ID
+			name:       "tie broken by an earlier round",
+			candidates: []string{"A", "B", "C", "D"},
+			ballots: [][]string{
+				{"A"}, {"A"}, {"A"}, {"A"},
+				{"B"}, {"B"},
+				{"C"}, {"C"}, {"C"},
+				{"D", "B"},
+			},
+			winner:     "A",
+			eliminated: []string{"D", "B", ""},
+			exhausted:  []int{0, 0, 3},
+		},
+		{
+			// B and C tie in both rounds, so the greater ID goes
+			name:       "tie in every round",
+			candidates: []string{"A", "B", "C", "D"},
+			ballots:    [][]string{{"A"}, {"A"}, {"B"}, {"C"}, {"D"}},
+			winner:     "A",
+			eliminated: []string{"D", "C", ""},
+			exhausted:  []int{0, 1, 2},
+		},
+		{
+			name:       "all ballots exhausted",
+			candidates: []string{"A", "B"},
+			ballots:    [][]string{{"X"}, {"Y", "Z"}},
+			winner:     "",
+			eliminated: []string{""},
+			exhausted:  []int{2},
+		},
+	}
+
+	for _, test := range tests {
+		winner, rounds := runInstantRunoff(test.candidates, test.ballots)
+		if winner != test.winner {
+			t.Errorf("%s: winner = %q, want %q", test.name, winner, test.winner)
+		}
+
+		eliminated := []string{}
+		exhausted := []int{}
+		for i, round := range rounds {
+			if round.Round != i+1 {
+				t.Errorf("%s: round %d numbered %d", test.name, i+1, round.Round)
+			}
+			eliminated = append(eliminated, round.Eliminated)
+			exhausted = append(exhausted, round.Exhausted)
+		}
+		if !reflect.DeepEqual(eliminated, test.eliminated) {
+			t.Errorf("%s: eliminated = %q, want %q", test.name, eliminated, test.eliminated)
+		}
+		if !reflect.DeepEqual(exhausted, test.exhausted) {
+			t.Errorf("%s: exhausted = %v, want %v", test.name, exhausted, test.exhausted)
+		}
+	}
+}
+
+func TestPickElimination(t *testing.T) {
+	rounds := []RunoffRound{
+		{Round: 1, Counts: map[string]int{"A": 5, "B": 2, "C": 3, "D": 2}},
+		{Round: 2, Counts: map[string]int{"A": 5, "B": 3, "C": 3, "D": 3}},
+	}
+
+	tests := []struct {
+		remaining []string
+		want      string
+	}{
+		{remaining: []string{"A", "B", "C", "D"}, want: "D"},
+		{remaining: []string{"B", "C"}, want: "B"},
+		{remaining: []string{"A", "C"}, want: "C"},
+		{remaining: []string{"B", "D"}, want: "D"},
+	}
+
+	for _, test := range tests {
+		if got := pickElimination(test.remaining, rounds); got != test.want {
+			t.Errorf("pickElimination(%q) = %q, want %q", test.remaining, got, test.want)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
@@ -10,18 +12,25 @@ import (
 
 //import format "fmt"
 
-// Voter defined as struct
+// Voter defined as struct. A voter is registered on the roll of a single
+// election; the same person registers separately for every election. The
+// vote itself is kept in a separate Ballot. Public state only knows the
+// voter by VoterHash; the national ID and name are kept in VoterDetails.
 type Voter struct {
-	NationalID       string `json:"CandidateID"`
-	Name             string `json:"Name"`
-	VotedCandidateID string `json:"VotedCandidateID"`
+	ElectionID string `json:"ElectionID"`
+	VoterHash  string `json:"VoterHash"`
 }
 
-// Candidate defined as struct
+// Candidate defined as struct. TotalVote is filled in by the tally and, in
+// ranked elections, counts first preferences. A withdrawn candidate keeps
+// its record, so its ID cannot be reused in the same election, but can no
+// longer be voted for and is left out of the results.
 type Candidate struct {
+	ElectionID  string `json:"ElectionID"`
 	CandidateID string `json:"CandidateID"`
 	Name        string `json:"Name"`
 	TotalVote   int    `json:"TotalVote"`
+	Withdrawn   bool   `json:"Withdrawn"`
 }
 
 // SmartContract defined as struct
@@ -42,22 +51,8 @@ func main() {
 func (smartcontract *SmartContract) Init(stub shim.ChaincodeStubInterface) peer.Response {
 	fmt.Println("=============== Start Init ===============")
 
-	candidates := []Candidate{
-		Candidate{CandidateID: "100", Name: "Finis Valorum", TotalVote: 0},
-		Candidate{CandidateID: "200", Name: "Palpatine", TotalVote: 0},
-		Candidate{CandidateID: "300", Name: "Bail Antilles", TotalVote: 0},
-	}
-
-	i := 0
-	for i < len(candidates) {
-		candidateAsBytes, _ := json.Marshal(candidates[i])
-		err := stub.PutState("CANDIDATE"+candidates[i].CandidateID, candidateAsBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		fmt.Print("Added candidate CANDIDATE", candidates[i].CandidateID, "Candidate name:", candidates[i].Name, "\n")
-		i = i + 1
-	}
+	// Elections and their candidates are created with createElection and
+	// registerCandidate, so there is nothing to seed here
 	fmt.Println("=============== End Init  ===============")
 	return shim.Success(nil)
 }
@@ -75,41 +70,130 @@ func (smartcontract *SmartContract) Invoke(stub shim.ChaincodeStubInterface) pee
 		return smartcontract.registerVoter(stub, args)
 	} else if function == "queryVoter" {
 		return smartcontract.queryVoter(stub, args)
+	} else if function == "queryVoterDetails" {
+		return smartcontract.queryVoterDetails(stub, args)
 	} else if function == "queryAllVoters" {
-		return smartcontract.queryAllVoters(stub)
+		return smartcontract.queryAllVoters(stub, args)
+	} else if function == "mapVoterID" {
+		return smartcontract.mapVoterID(stub, args)
 	} else if function == "queryCandidate" {
 		return smartcontract.queryCandidate(stub, args)
+	} else if function == "registerCandidate" {
+		return smartcontract.registerCandidate(stub, args)
+	} else if function == "withdrawCandidate" {
+		return smartcontract.withdrawCandidate(stub, args)
 	} else if function == "queryAllCandidates" {
-		return smartcontract.queryAllCandidates(stub)
+		return smartcontract.queryAllCandidates(stub, args)
 	} else if function == "addVote" {
 		return smartcontract.addVote(stub, args)
+	} else if function == "commitVote" {
+		return smartcontract.commitVote(stub, args)
+	} else if function == "revealVote" {
+		return smartcontract.revealVote(stub, args)
+	} else if function == "delegateVote" {
+		return smartcontract.delegateVote(stub, args)
+	} else if function == "revokeDelegation" {
+		return smartcontract.revokeDelegation(stub, args)
 	} else if function == "getHistory" {
 		return smartcontract.getHistory(stub, args)
+	} else if function == "createElection" {
+		return smartcontract.createElection(stub, args)
+	} else if function == "queryElection" {
+		return smartcontract.queryElection(stub, args)
+	} else if function == "queryAllElections" {
+		return smartcontract.queryAllElections(stub)
+	} else if function == "scheduleElection" {
+		return smartcontract.scheduleElection(stub, args)
+	} else if function == "setEligibility" {
+		return smartcontract.setEligibility(stub, args)
+	} else if function == "openRegistration" {
+		return smartcontract.openRegistration(stub, args)
+	} else if function == "openVoting" {
+		return smartcontract.openVoting(stub, args)
+	} else if function == "closeVoting" {
+		return smartcontract.closeVoting(stub, args)
+	} else if function == "tallyElection" || function == "tally" {
+		return smartcontract.tallyElection(stub, args)
 	}
 	return shim.Error("Invalid Smart Contract function name.")
 }
 
+// registerVoter adds the invoking client to the election's roll, under the
+// national ID mapped by mapVoterID to the voterID attribute of its
+// certificate, with "name" from the transient map. Each national ID and each client identity can register once per
+// election, and the client must be eligible to vote in it.
 func (smartcontract *SmartContract) registerVoter(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	fmt.Println("=============== Start Register Voter =============== ")
 
-	if len(args) != 2 {
+	if len(args) != 1 {
 		return shim.Error("Invalid number of arguments.")
 	}
 
-	nationalID := args[0]
-	name := args[1]
+	electionID := args[0]
+	name, err := getTransientValue(stub, "name")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	voter := Voter{NationalID: nationalID, Name: name, VotedCandidateID: ""}
-	voterAsBytes, _ := json.Marshal(voter)
-	err := stub.PutState("VOTER"+nationalID, voterAsBytes)
+	election, err := requireElectionStatus(stub, electionID, StatusRegistration)
 	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireEligibleVoter(stub, election); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hash, nationalID, err := getCallerNationalIDHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voterKey, err := stub.CreateCompositeKey("VOTER", []string{electionID, hash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voterAsBytes, err := stub.GetState(voterKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voterAsBytes != nil {
 		return shim.Error("Voter already registered")
 	}
-	fmt.Print("Added voter. VOTER", voter.NationalID, ", Voter info", voter)
+
+	identityHash, err := getCallerIdentityHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	identityKey, err := stub.CreateCompositeKey("VOTERIDENTITY", []string{electionID, identityHash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	registeredHash, err := stub.GetState(identityKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if registeredHash != nil {
+		return shim.Error("Caller already registered as a voter")
+	}
+
+	voter := Voter{ElectionID: electionID, VoterHash: hash}
+	err = putVoter(stub, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(identityKey, []byte(hash))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putVoterDetails(stub, VoterDetails{ElectionID: electionID, VoterHash: hash, NationalID: nationalID, Name: name})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("Added voter. VOTER", voter.VoterHash)
 	fmt.Println("=============== End Register Voter =============== ")
 	return shim.Success(nil)
 }
 
+// queryVoter returns the caller's public roll entry
 func (smartcontract *SmartContract) queryVoter(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	fmt.Println("=============== Start Query Voter =============== ")
 
@@ -117,34 +201,41 @@ func (smartcontract *SmartContract) queryVoter(stub shim.ChaincodeStubInterface,
 		return shim.Error("Invalid number of arguments.")
 	}
 
-	nationalID := args[0]
-	voterAsBytes, err := stub.GetState("VOTER" + nationalID)
-
+	electionID := args[0]
+	hash, err := getCallerVoterHash(stub, electionID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	voter, err := getVoter(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voterAsBytes, _ := json.Marshal(voter)
 
-	jsonResp := "VoterID: VOTER" + nationalID + ", Voter info: " + string(voterAsBytes)
+	jsonResp := "VoterID: VOTER" + hash + ", Voter info: " + string(voterAsBytes)
 	fmt.Println(jsonResp)
 
 	fmt.Println("=============== End Query Voter =============== ")
-	return shim.Success(nil)
+	return shim.Success(voterAsBytes)
 }
 
-func (smartcontract *SmartContract) queryAllVoters(stub shim.ChaincodeStubInterface) peer.Response {
+func (smartcontract *SmartContract) queryAllVoters(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	fmt.Println("=============== Start Query All Voters =============== ")
 
-	startKey := "VOTER0"
-	endKey := "VOTER99999"
-
-	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if len(args) != 1 {
+		return shim.Error("Invalid number of arguments.")
+	}
 
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("VOTER", []string{args[0]})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	defer resultsIterator.Close()
 
-	resultsIterator.Close()
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
 
+	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
@@ -152,96 +243,191 @@ func (smartcontract *SmartContract) queryAllVoters(stub shim.ChaincodeStubInterf
 		}
 		jsonResp := "VoterID: " + queryResponse.Key + ", Voter info: " + string(queryResponse.Value)
 		fmt.Println(jsonResp)
+
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.Write(queryResponse.Value)
+		bArrayMemberAlreadyWritten = true
 	}
+	buffer.WriteString("]")
 
 	fmt.Println("=============== End Query All Voters =============== ")
-	return shim.Success(nil)
+	return shim.Success(buffer.Bytes())
 }
 
 func (smartcontract *SmartContract) queryCandidate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	fmt.Println("=============== Start Query Candidate =============== ")
 
-	if len(args) != 1 {
+	if len(args) != 2 {
 		return shim.Error("Invalid number of arguments.")
 	}
 
-	candidateID := args[0]
-	candidateAsBytes, err := stub.GetState("CANDIDATE" + candidateID)
-
+	electionID := args[0]
+	candidateID := args[1]
+	candidate, err := getCandidate(stub, electionID, candidateID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	candidateAsBytes, _ := json.Marshal(candidate)
 
 	jsonResp := "CandidateID: CANDIDATE" + candidateID + ", Candidate info: " + string(candidateAsBytes)
 	fmt.Println(jsonResp)
 
 	fmt.Println("=============== End Query Candidate =============== ")
-	return shim.Success(nil)
+	return shim.Success(candidateAsBytes)
 }
 
-func (smartcontract *SmartContract) queryAllCandidates(stub shim.ChaincodeStubInterface) peer.Response {
-	fmt.Println("=============== Start Query All Candidates =============== ")
+// registerCandidate adds a candidate to an election that has not opened
+// for voting yet
+func (smartcontract *SmartContract) registerCandidate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Register Candidate =============== ")
 
-	startKey := "CANDIDATE0"
-	endKey := "CANDIDATE99999"
+	if len(args) != 3 {
+		return shim.Error("Invalid number of arguments.")
+	}
 
-	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	electionID := args[0]
+	candidateID := args[1]
+	name := args[2]
+	if candidateID == "" || name == "" {
+		return shim.Error("Candidate ID and name must not be empty")
+	}
+	if strings.Contains(candidateID, ",") {
+		return shim.Error("Candidate ID must not contain a comma")
+	}
 
-	if err != nil {
+	if err := requireElectionAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireElectionNotOpened(stub, electionID); err != nil {
 		return shim.Error(err.Error())
 	}
 
-	resultsIterator.Close()
+	candidateKey, err := stub.CreateCompositeKey("CANDIDATE", []string{electionID, candidateID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	candidateAsBytes, err := stub.GetState(candidateKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if candidateAsBytes != nil {
+		return shim.Error("Candidate ID already used in this election")
+	}
 
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		jsonResp := "CandidateID: " + queryResponse.Key + ", Candidate info: " + string(queryResponse.Value)
-		fmt.Println(jsonResp)
+	candidate := Candidate{ElectionID: electionID, CandidateID: candidateID, Name: name, TotalVote: 0}
+	err = putCandidate(stub, candidate)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	fmt.Println("=============== End Query All Voters =============== ")
+	fmt.Print("Added candidate CANDIDATE", candidate.CandidateID, "Candidate name:", candidate.Name, "\n")
+	fmt.Println("=============== End Register Candidate =============== ")
 	return shim.Success(nil)
 }
 
-func (smartcontract *SmartContract) addVote(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	fmt.Println("=============== Start Add Vote =============== ")
+// withdrawCandidate marks a candidate as withdrawn. Withdrawal is only
+// possible before voting opens, so a withdrawn candidate never holds votes;
+// ballots naming one are rejected and tallies leave it out.
+func (smartcontract *SmartContract) withdrawCandidate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Withdraw Candidate =============== ")
 
 	if len(args) != 2 {
 		return shim.Error("Invalid number of arguments.")
 	}
 
-	voterNationalID := args[0]
-	candidateID := args[1]
+	if err := requireElectionAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireElectionNotOpened(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	voterAsBytes, err := stub.GetState("VOTER" + voterNationalID)
-	candidateAsBytes, err := stub.GetState("CANDIDATE" + candidateID)
+	candidate, err := getCandidate(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if candidate.Withdrawn {
+		return shim.Error("Candidate has already withdrawn")
+	}
 
+	candidate.Withdrawn = true
+	err = putCandidate(stub, candidate)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	voter := Voter{}
-	candidate := Candidate{}
+	fmt.Println("Withdrew candidate", candidate.CandidateID, "from election", candidate.ElectionID)
+	fmt.Println("=============== End Withdraw Candidate =============== ")
+	return shim.Success(nil)
+}
 
-	json.Unmarshal(voterAsBytes, &voter)
-	json.Unmarshal(candidateAsBytes, &candidate)
+func (smartcontract *SmartContract) queryAllCandidates(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Query All Candidates =============== ")
 
-	if voter.VotedCandidateID != "" {
-		return shim.Error("Voter already voted a candidate")
+	if len(args) != 1 {
+		return shim.Error("Invalid number of arguments.")
 	}
 
-	voter.VotedCandidateID = candidateID
-	candidate.TotalVote++
+	candidates, err := getCandidates(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	candidatesAsBytes, _ := json.Marshal(candidates)
+	fmt.Println("Candidates:", string(candidatesAsBytes))
 
-	voterByBytes, _ := json.Marshal(voter)
-	candidateByBytes, _ := json.Marshal(candidate)
+	fmt.Println("=============== End Query All Candidates =============== ")
+	return shim.Success(candidatesAsBytes)
+}
+
+// addVote casts the invoking voter's ballot. In ranked elections the choice is a comma separated list
+// of candidate IDs, most preferred first.
+func (smartcontract *SmartContract) addVote(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	fmt.Println("=============== Start Add Vote =============== ")
+
+	if len(args) != 2 {
+		return shim.Error("Invalid number of arguments.")
+	}
 
-	err = stub.PutState("VOTER"+voter.NationalID, voterByBytes)
-	err = stub.PutState("CANDIDATE"+candidate.CandidateID, candidateByBytes)
+	electionID := args[0]
+	choice := args[1]
 
+	election, err := requireElectionStatus(stub, electionID, StatusOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.SecretBallot {
+		return shim.Error("Election uses secret ballots; use commitVote")
+	}
+	if err := requireEligibleVoter(stub, election); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hash, err := getCallerVoterHash(stub, electionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = getVoter(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballot, err := getBallot(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ballot != nil {
+		return shim.Error("Voter already voted a candidate")
+	}
+	delegation, err := getDelegation(stub, electionID, hash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegation != nil {
+		return shim.Error("Voter delegated the vote; revoke the delegation first")
+	}
+
+	err = castBallot(stub, election, Ballot{ElectionID: electionID, VoterHash: hash}, choice)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -253,9 +439,19 @@ func (smartcontract *SmartContract) addVote(stub shim.ChaincodeStubInterface, ar
 func (smartcontract *SmartContract) getHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	fmt.Println("=============== Start Get History =============== ")
 
-	candidateID := "CANDIDATE" + args[0]
-	historyInterface, _ := stub.GetHistoryForKey(candidateID)
-	historyInterface.Close()
+	if len(args) != 2 {
+		return shim.Error("Invalid number of arguments.")
+	}
+
+	candidateKey, err := stub.CreateCompositeKey("CANDIDATE", []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	historyInterface, err := stub.GetHistoryForKey(candidateKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer historyInterface.Close()
 
 	for historyInterface.HasNext() {
 		queryResponse, err := historyInterface.Next()
@@ -268,3 +464,89 @@ func (smartcontract *SmartContract) getHistory(stub shim.ChaincodeStubInterface,
 	fmt.Println("=============== End Get History =============== ")
 	return shim.Success(nil)
 }
+
+func getVoter(stub shim.ChaincodeStubInterface, electionID string, hash string) (Voter, error) {
+	voter := Voter{}
+
+	voterKey, err := stub.CreateCompositeKey("VOTER", []string{electionID, hash})
+	if err != nil {
+		return voter, err
+	}
+	voterAsBytes, err := stub.GetState(voterKey)
+	if err != nil {
+		return voter, err
+	}
+	if voterAsBytes == nil {
+		return voter, fmt.Errorf("Voter is not registered for election %s", electionID)
+	}
+
+	err = json.Unmarshal(voterAsBytes, &voter)
+	return voter, err
+}
+
+func putVoter(stub shim.ChaincodeStubInterface, voter Voter) error {
+	voterKey, err := stub.CreateCompositeKey("VOTER", []string{voter.ElectionID, voter.VoterHash})
+	if err != nil {
+		return err
+	}
+	voterAsBytes, err := json.Marshal(voter)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(voterKey, voterAsBytes)
+}
+
+func getCandidate(stub shim.ChaincodeStubInterface, electionID string, candidateID string) (Candidate, error) {
+	candidate := Candidate{}
+
+	candidateKey, err := stub.CreateCompositeKey("CANDIDATE", []string{electionID, candidateID})
+	if err != nil {
+		return candidate, err
+	}
+	candidateAsBytes, err := stub.GetState(candidateKey)
+	if err != nil {
+		return candidate, err
+	}
+	if candidateAsBytes == nil {
+		return candidate, fmt.Errorf("Candidate %s does not stand in election %s", candidateID, electionID)
+	}
+
+	err = json.Unmarshal(candidateAsBytes, &candidate)
+	return candidate, err
+}
+
+// getCandidates returns the candidates of an election ordered by ID
+func getCandidates(stub shim.ChaincodeStubInterface, electionID string) ([]Candidate, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("CANDIDATE", []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	candidates := []Candidate{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		candidate := Candidate{}
+		err = json.Unmarshal(queryResponse.Value, &candidate)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+func putCandidate(stub shim.ChaincodeStubInterface, candidate Candidate) error {
+	candidateKey, err := stub.CreateCompositeKey("CANDIDATE", []string{candidate.ElectionID, candidate.CandidateID})
+	if err != nil {
+		return err
+	}
+	candidateAsBytes, err := json.Marshal(candidate)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(candidateKey, candidateAsBytes)
+}
@@ -0,0 +1,11 @@
+module github.com/yigitpolat/Hyperledger-Fabric-Chaincodes
+
+go 1.12
+
+// Fabric 1.4 predates modules, so the versions of its own dependencies are
+// pinned here to the ones it was released with.
+require (
+	github.com/golang/protobuf v1.3.2
+	github.com/hyperledger/fabric v1.4.12
+	google.golang.org/grpc v1.23.0
+)
@@ -0,0 +1,155 @@
+// Package money provides a fixed-point decimal Amount shared by the
+// chaincodes in this repository. Amounts are whole multiples of
+// 1/10^Scale, arithmetic is overflow-checked, and the JSON form is a
+// canonical decimal string, so every endorsing peer computes and stores
+// byte-identical values.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places carried by every Amount
+const Scale = 2
+
+// ErrOverflow is returned when a result does not fit in an Amount
+var ErrOverflow = errors.New("money: amount overflows")
+
+// Amount is a money value stored as an integer count of 1/10^Scale units
+type Amount int64
+
+// Parse reads a decimal such as "12", "-3.5" or "1000.25". At most Scale
+// decimal places are accepted; nothing is ever rounded.
+func Parse(s string) (Amount, error) {
+	digits := s
+	negative := false
+	if strings.HasPrefix(digits, "-") {
+		negative = true
+		digits = digits[1:]
+	}
+
+	parts := strings.SplitN(digits, ".", 2)
+	whole := parts[0]
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+		if fraction == "" {
+			return 0, fmt.Errorf("money: %q is not a valid amount", s)
+		}
+	}
+	if whole == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("money: %q is not a valid amount", s)
+	}
+	if len(fraction) > Scale {
+		return 0, fmt.Errorf("money: %q has more than %d decimal places", s, Scale)
+	}
+
+	units := whole + fraction + strings.Repeat("0", Scale-len(fraction))
+	if negative {
+		units = "-" + units
+	}
+	value, err := strconv.ParseInt(units, 10, 64)
+	if err != nil {
+		return 0, ErrOverflow
+	}
+	return Amount(value), nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for literals.
+func MustParse(s string) Amount {
+	amount, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+// String formats the amount with exactly Scale decimal places
+func (a Amount) String() string {
+	sign := ""
+	abs := uint64(a)
+	if a < 0 {
+		sign = "-"
+		abs = uint64(-(a + 1)) + 1
+	}
+	unit := uint64(math.Pow10(Scale))
+	return fmt.Sprintf("%s%d.%0*d", sign, abs/unit, Scale, abs%unit)
+}
+
+// Add returns a+b or ErrOverflow
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, ErrOverflow
+	}
+	return sum, nil
+}
+
+// Sub returns a-b or ErrOverflow
+func (a Amount) Sub(b Amount) (Amount, error) {
+	difference := a - b
+	if (b > 0 && difference > a) || (b < 0 && difference < a) {
+		return 0, ErrOverflow
+	}
+	return difference, nil
+}
+
+// Neg returns -a or ErrOverflow
+func (a Amount) Neg() (Amount, error) {
+	if a == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return -a, nil
+}
+
+// MulRate multiplies a by a fixed-point rate with the given number of
+// decimal places, truncating toward zero to the nearest 1/10^Scale unit
+func (a Amount) MulRate(rate int64, decimals int) (Amount, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(rate))
+	product.Quo(product, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	if !product.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return Amount(product.Int64()), nil
+}
+
+// MarshalJSON encodes the amount as a decimal string such as "12.50"
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts the canonical string form. Bare JSON numbers are
+// also read, so records written before amounts were decimal still load.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, "\"") {
+		unquoted, err := strconv.Unquote(text)
+		if err != nil {
+			return err
+		}
+		text = unquoted
+	}
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
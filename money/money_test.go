@@ -0,0 +1,216 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "12", want: 1200},
+		{in: "12.5", want: 1250},
+		{in: "1000.25", want: 100025},
+		{in: "0.01", want: 1},
+		{in: "-3.5", want: -350},
+		{in: "-0.01", want: -1},
+		{in: "-0", want: 0},
+		{in: "92233720368547758.07", want: math.MaxInt64},
+		{in: "-92233720368547758.08", want: math.MinInt64},
+		{in: "1.001", wantErr: true},
+		{in: "-1.999", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "5.", wantErr: true},
+		{in: "+5", wantErr: true},
+		{in: "--5", wantErr: true},
+		{in: "1,5", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: " 1", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "92233720368547758.08", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %d, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %s", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{in: 0, want: "0.00"},
+		{in: 1, want: "0.01"},
+		{in: 1250, want: "12.50"},
+		{in: -350, want: "-3.50"},
+		{in: -1, want: "-0.01"},
+		{in: math.MaxInt64, want: "92233720368547758.07"},
+		{in: math.MinInt64, want: "-92233720368547758.08"},
+	}
+
+	for _, test := range tests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(test.in), got, test.want)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	tests := []struct {
+		a, b            Amount
+		sum, difference Amount
+		sumErr, diffErr bool
+	}{
+		{a: 100, b: 50, sum: 150, difference: 50},
+		{a: -100, b: 50, sum: -50, difference: -150},
+		{a: math.MaxInt64, b: 1, sumErr: true, difference: math.MaxInt64 - 1},
+		{a: math.MinInt64, b: 1, sum: math.MinInt64 + 1, diffErr: true},
+		{a: math.MinInt64, b: -1, sumErr: true, difference: math.MinInt64 + 1},
+		{a: math.MaxInt64, b: -1, sum: math.MaxInt64 - 1, diffErr: true},
+		{a: 0, b: math.MinInt64, sum: math.MinInt64, diffErr: true},
+	}
+
+	for _, test := range tests {
+		sum, err := test.a.Add(test.b)
+		if test.sumErr {
+			if err != ErrOverflow {
+				t.Errorf("%d.Add(%d) = %d, %v, want ErrOverflow", test.a, test.b, sum, err)
+			}
+		} else if err != nil || sum != test.sum {
+			t.Errorf("%d.Add(%d) = %d, %v, want %d", test.a, test.b, sum, err, test.sum)
+		}
+
+		difference, err := test.a.Sub(test.b)
+		if test.diffErr {
+			if err != ErrOverflow {
+				t.Errorf("%d.Sub(%d) = %d, %v, want ErrOverflow", test.a, test.b, difference, err)
+			}
+		} else if err != nil || difference != test.difference {
+			t.Errorf("%d.Sub(%d) = %d, %v, want %d", test.a, test.b, difference, err, test.difference)
+		}
+	}
+}
+
+func TestNeg(t *testing.T) {
+	if got, err := Amount(350).Neg(); err != nil || got != -350 {
+		t.Errorf("Amount(350).Neg() = %d, %v, want -350", got, err)
+	}
+	if _, err := Amount(math.MinInt64).Neg(); err != ErrOverflow {
+		t.Errorf("Amount(MinInt64).Neg() error = %v, want ErrOverflow", err)
+	}
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		a        Amount
+		rate     int64
+		decimals int
+		want     Amount
+		wantErr  bool
+	}{
+		{a: 10000, rate: 1500000, decimals: 6, want: 15000},
+		{a: 1, rate: 500000, decimals: 6, want: 0},
+		{a: 999, rate: 1, decimals: 3, want: 0},
+		{a: -1, rate: 500000, decimals: 6, want: 0},
+		{a: -333, rate: 333333, decimals: 6, want: -110},
+		{a: 12345, rate: 0, decimals: 6, want: 0},
+		{a: math.MaxInt64, rate: 1000000, decimals: 6, want: math.MaxInt64},
+		{a: math.MaxInt64, rate: 2000000, decimals: 6, wantErr: true},
+		{a: math.MinInt64, rate: 2, decimals: 0, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := test.a.MulRate(test.rate, test.decimals)
+		if test.wantErr {
+			if err != ErrOverflow {
+				t.Errorf("%d.MulRate(%d, %d) = %d, %v, want ErrOverflow", test.a, test.rate, test.decimals, got, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%d.MulRate(%d, %d) = %d, %v, want %d", test.a, test.rate, test.decimals, got, err, test.want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, amount := range []Amount{0, 1, -1, 1250, -350, math.MaxInt64, math.MinInt64} {
+		data, err := json.Marshal(amount)
+		if err != nil {
+			t.Fatalf("Marshal(%d) returned error: %s", amount, err)
+		}
+		if want := `"` + amount.String() + `"`; string(data) != want {
+			t.Errorf("Marshal(%d) = %s, want %s", amount, data, want)
+		}
+
+		var decoded Amount
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unmarshal(%s) returned error: %s", data, err)
+		}
+		if decoded != amount {
+			t.Errorf("Unmarshal(%s) = %d, want %d", data, decoded, amount)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: `"12.50"`, want: 1250},
+		{in: `12`, want: 1200},
+		{in: `12.5`, want: 1250},
+		{in: `-3`, want: -300},
+		{in: `null`, want: 0},
+		{in: `"1.001"`, wantErr: true},
+		{in: `"abc"`, wantErr: true},
+		{in: `1e3`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		var got Amount
+		err := json.Unmarshal([]byte(test.in), &got)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %d, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", test.in, got, err, test.want)
+		}
+	}
+
+	// Amounts embedded in records decode from either form.
+	var record struct {
+		Balance Amount `json:"Balance"`
+	}
+	if err := json.Unmarshal([]byte(`{"Balance":"7.05"}`), &record); err != nil || record.Balance != 705 {
+		t.Errorf("Unmarshal record = %d, %v, want 705", record.Balance, err)
+	}
+}